@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	ssh "github.com/charmbracelet/ssh"
+)
+
+const adminSection = "Admin"
+
+// --- Admin Keys ---
+
+// authorizedKeys holds the owner's public keys, re-read whenever the
+// authorized_keys file changes so keys can be added without a restart.
+type authorizedKeys struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	keys    []ssh.PublicKey
+}
+
+// admins reads cfg.AdminKeysPath; main sets the path at startup.
+var admins = &authorizedKeys{}
+
+// authorized reports whether key is listed in the authorized_keys file.
+func (a *authorizedKeys) authorized(key ssh.PublicKey) bool {
+	if key == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.reload(); err != nil {
+		slog.Error("Failed to load admin keys", "err", err)
+	}
+	for _, k := range a.keys {
+		if ssh.KeysEqual(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload parses the file again if it was modified since the last read.
+// A missing file simply means there are no admins.
+func (a *authorizedKeys) reload() error {
+	fi, err := os.Stat(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		a.keys = nil
+		a.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(a.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+	var keys []ssh.PublicKey
+	for lineNo, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			slog.Warn("Skipping invalid admin key", "path", a.path, "line", lineNo+1, "err", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	a.keys = keys
+	a.modTime = fi.ModTime()
+	return nil
+}
+
+// --- Admin Tab ---
+
+var adminPanels = []string{"Sessions", "Stats", "Guestbook", "Bans", "Recordings"}
+
+var (
+	styleAdminPanelActive   = lipgloss.NewStyle().Bold(true).Foreground(activeTabColor)
+	styleAdminPanelInactive = lipgloss.NewStyle().Foreground(inactiveTabFg)
+	styleAdminHeading       = lipgloss.NewStyle().Bold(true).Underline(true)
+)
+
+// adminModel is the owner-only tab with live sessions, visitor stats,
+// guestbook moderation, bans and session recordings.
+type adminModel struct {
+	panel     int
+	vp        viewport.Model
+	modCursor int          // selected entry in the moderation queue
+	banCursor int          // selected ban
+	recCursor int          // selected recording
+	form      *form        // "ban an address" form, when open
+	replay    *replayModel // recording being played back, when open
+	status    string       // result of the last admin action
+	logger    *slog.Logger
+}
+
+// banFields is the form for banning an address from the Bans panel.
+var banFields = []fieldSpec{
+	{Label: "IP or CIDR", Required: true, MaxLen: 64, Check: func(v string) error {
+		_, err := banTarget(v)
+		return err
+	}},
+	{Label: "Duration (e.g. 24h, empty for permanent)", MaxLen: 16, Check: func(v string) error {
+		_, err := parseBanDuration(v)
+		return err
+	}},
+	{Label: "Reason", MaxLen: 120},
+}
+
+func newAdminModel() adminModel {
+	return adminModel{vp: viewport.New(0, 0)}
+}
+
+func (a *adminModel) update(msg tea.Msg) tea.Cmd {
+	if a.form != nil {
+		return a.updateBanForm(msg)
+	}
+	if a.replay != nil {
+		cmd, done := a.replay.update(msg)
+		if done {
+			a.replay = nil
+		}
+		return cmd
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "tab":
+			a.panel = (a.panel + 1) % len(adminPanels)
+			a.vp.GotoTop()
+			return nil
+		case "shift+tab":
+			a.panel = (a.panel - 1 + len(adminPanels)) % len(adminPanels)
+			a.vp.GotoTop()
+			return nil
+		}
+		if adminPanels[a.panel] == "Guestbook" {
+			a.moderate(keyMsg.String())
+			return nil
+		}
+		if adminPanels[a.panel] == "Bans" {
+			return a.manageBans(keyMsg.String())
+		}
+		if adminPanels[a.panel] == "Recordings" {
+			return a.manageRecordings(keyMsg.String())
+		}
+	}
+
+	var cmd tea.Cmd
+	a.vp, cmd = a.vp.Update(msg)
+	return cmd
+}
+
+func (a *adminModel) view(w, h int) string {
+	var panelTitles []string
+	for i, title := range adminPanels {
+		style := styleAdminPanelInactive
+		if i == a.panel {
+			style = styleAdminPanelActive
+		}
+		panelTitles = append(panelTitles, style.Render(title))
+	}
+	panelBar := " " + strings.Join(panelTitles, "  ")
+
+	if a.form != nil {
+		return lipgloss.JoinVertical(lipgloss.Left, panelBar, a.status,
+			lipgloss.NewStyle().PaddingLeft(1).MaxHeight(h-2).Render(a.form.view(w-4)))
+	}
+	if a.replay != nil {
+		return lipgloss.JoinVertical(lipgloss.Left, panelBar, a.replay.view(w, h-1))
+	}
+
+	var body string
+	switch adminPanels[a.panel] {
+	case "Sessions":
+		body = renderAdminSessions()
+	case "Stats":
+		body = renderAdminStats()
+	case "Guestbook":
+		body = a.renderModeration(w - 2)
+	case "Bans":
+		body = a.renderBans()
+	case "Recordings":
+		body = a.renderRecordings()
+	}
+
+	a.vp.Width = w
+	a.vp.Height = h - 2
+	if a.vp.Height < 1 {
+		a.vp.Height = 1
+	}
+	a.vp.SetContent(lipgloss.NewStyle().PaddingLeft(1).Render(body))
+	return lipgloss.JoinVertical(lipgloss.Left, panelBar, a.status, a.vp.View())
+}
+
+func renderAdminSessions() string {
+	sessions := hub.list()
+	var b strings.Builder
+	b.WriteString(styleAdminHeading.Render(fmt.Sprintf("Live sessions (%d)", len(sessions))))
+	b.WriteString("\n\n")
+	for _, s := range sessions {
+		who := s.User
+		if s.Admin {
+			who += " (admin)"
+		}
+		key := s.Fingerprint
+		if key == "" {
+			key = "no key"
+		}
+		b.WriteString(styleItemTitle.Render(who))
+		b.WriteString(styleItemSubtitle.Render(fmt.Sprintf(" %s • %s", s.RemoteAddr, time.Since(s.Started).Round(time.Second))))
+		b.WriteString("\n")
+		b.WriteString(styleItemDesc.Render(fmt.Sprintf("tab: %s • %s", s.Tab, s.ClientVersion)))
+		b.WriteString("\n")
+		b.WriteString(styleItemDesc.Render(key))
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
+
+func renderAdminStats() string {
+	st := hub.stats()
+	rows := [][2]string{
+		{"Active sessions", fmt.Sprint(st.Active)},
+		{"Peak concurrent", fmt.Sprint(st.Peak)},
+		{"Total connections", fmt.Sprint(st.Total)},
+		{"Unique visitors", fmt.Sprint(st.Visitors)},
+		{"Uptime", st.Uptime.Round(time.Second).String()},
+	}
+	var b strings.Builder
+	b.WriteString(styleAdminHeading.Render("Visitor stats (since start)"))
+	b.WriteString("\n\n")
+	for _, r := range rows {
+		b.WriteString(fmt.Sprintf("%-20s %s\n", r[0], styleItemTitle.Render(r[1])))
+	}
+
+	if !analytics.enabled() {
+		return b.String()
+	}
+	sum, err := analytics.summary()
+	if err != nil {
+		b.WriteString("\n" + styleFormError.Render("Failed to read analytics: "+err.Error()) + "\n")
+		return b.String()
+	}
+	b.WriteString("\n")
+	b.WriteString(styleAdminHeading.Render("All-time (analytics store)"))
+	b.WriteString("\n\n")
+	rows = [][2]string{
+		{"Visits", fmt.Sprint(sum.Visits)},
+		{"Unique keys", fmt.Sprint(sum.UniqueKeys)},
+		{"Average visit", sum.AvgDuration.Round(time.Second).String()},
+	}
+	if !sum.Oldest.IsZero() {
+		rows = append(rows, [2]string{"Since", sum.Oldest.Format("Jan 2, 2006")})
+	}
+	for _, r := range rows {
+		b.WriteString(fmt.Sprintf("%-20s %s\n", r[0], styleItemTitle.Render(r[1])))
+	}
+	b.WriteString("\n")
+	b.WriteString(styleItemTitle.Render("Time spent per tab"))
+	b.WriteString("\n")
+	for _, tab := range sum.topTabs() {
+		b.WriteString(fmt.Sprintf("%-20s %s\n", tab, sum.Dwell[tab].Round(time.Second)))
+	}
+	return b.String()
+}
+
+// moderate handles keys on the guestbook moderation panel.
+func (a *adminModel) moderate(key string) {
+	pending := guestbook.byStatus(entryPending)
+	switch key {
+	case "up", "k":
+		if a.modCursor > 0 {
+			a.modCursor--
+		}
+	case "down", "j":
+		if a.modCursor < len(pending)-1 {
+			a.modCursor++
+		}
+	case "a", "x":
+		if a.modCursor >= len(pending) {
+			return
+		}
+		status := entryApproved
+		if key == "x" {
+			status = entryRejected
+		}
+		e := pending[a.modCursor]
+		if err := guestbook.moderate(e.ID, status); err != nil {
+			a.status = styleFormError.Render(" " + err.Error())
+			return
+		}
+		a.status = styleItemSubtitle.Render(fmt.Sprintf(" Message from %s %s", e.Name, status))
+	}
+}
+
+func (a *adminModel) renderModeration(width int) string {
+	pending := guestbook.byStatus(entryPending)
+	a.modCursor = max(0, min(a.modCursor, len(pending)-1))
+
+	var b strings.Builder
+	b.WriteString(styleAdminHeading.Render(fmt.Sprintf("Moderation queue (%d)", len(pending))))
+	b.WriteString("\n")
+	b.WriteString(styleItemSubtitle.Render("↑/↓: select • a: approve • x: reject"))
+	b.WriteString("\n\n")
+	for i, e := range pending {
+		entry := renderGuestbookEntry(e, width-2)
+		if i == a.modCursor {
+			entry = styleSelectedBorder.Render(entry)
+		} else {
+			entry = styleNormal.Render(entry)
+		}
+		b.WriteString(entry)
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
+
+// manageBans handles keys on the bans panel.
+func (a *adminModel) manageBans(key string) tea.Cmd {
+	active := bans.list()
+	switch key {
+	case "up", "k":
+		if a.banCursor > 0 {
+			a.banCursor--
+		}
+	case "down", "j":
+		if a.banCursor < len(active)-1 {
+			a.banCursor++
+		}
+	case "a":
+		a.form = newForm("Ban an address", banFields, nil)
+		a.status = ""
+		return a.form.setFocus(0)
+	case "u":
+		if a.banCursor >= len(active) {
+			return nil
+		}
+		target := active[a.banCursor].Target
+		if err := bans.remove(target); err != nil {
+			a.status = styleFormError.Render(" " + err.Error())
+			return nil
+		}
+		a.logger.Info("Admin unbanned", logKeyIP, target)
+		a.status = styleItemSubtitle.Render(" Unbanned " + target)
+	}
+	return nil
+}
+
+func (a *adminModel) updateBanForm(msg tea.Msg) tea.Cmd {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			a.form = nil
+			return nil
+		case "ctrl+s":
+			if !a.form.validate() {
+				return nil
+			}
+			v := a.form.values()
+			d, _ := parseBanDuration(v[1]) // Checked by validate
+			reason := strings.TrimSpace(v[2])
+			if reason == "" {
+				reason = "banned from the admin tab"
+			}
+			entry, err := bans.add(v[0], reason, banSourceAdmin, d)
+			if err != nil {
+				a.form.err = err.Error()
+				return nil
+			}
+			kickBanned(entry)
+			a.logger.Info("Admin banned", logKeyIP, entry.Target, "reason", reason)
+			a.form = nil
+			a.status = styleItemSubtitle.Render(" Banned " + entry.Target)
+			return nil
+		}
+	}
+	return a.form.update(msg)
+}
+
+// parseBanDuration reads the form's duration, where empty means permanent.
+func parseBanDuration(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err == nil && d < 0 {
+		err = errors.New("duration must not be negative")
+	}
+	return d, err
+}
+
+func (a *adminModel) renderBans() string {
+	active := bans.list()
+	a.banCursor = max(0, min(a.banCursor, len(active)-1))
+
+	var b strings.Builder
+	b.WriteString(styleAdminHeading.Render(fmt.Sprintf("Active bans (%d)", len(active))))
+	b.WriteString("\n")
+	b.WriteString(styleItemSubtitle.Render("↑/↓: select • a: ban an address • u: unban"))
+	b.WriteString("\n\n")
+	if len(cfg.allowNets) > 0 || len(cfg.denyNets) > 0 {
+		b.WriteString(styleItemDesc.Render(fmt.Sprintf("allow: %s • deny: %s",
+			orNone(cfg.AllowCIDRs), orNone(cfg.DenyCIDRs))))
+		b.WriteString("\n\n")
+	}
+	for i, entry := range active {
+		expires := "permanent"
+		if !entry.Expires.IsZero() {
+			expires = "expires in " + time.Until(entry.Expires).Round(time.Second).String()
+		}
+		row := styleItemTitle.Render(entry.Target) +
+			styleItemSubtitle.Render(fmt.Sprintf(" %s • %s", entry.Source, expires)) + "\n" +
+			styleItemDesc.Render(entry.Reason)
+		if i == a.banCursor {
+			row = styleSelectedBorder.Render(row)
+		} else {
+			row = styleNormal.Render(row)
+		}
+		b.WriteString(row)
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
+
+// manageRecordings handles keys on the recordings panel.
+func (a *adminModel) manageRecordings(key string) tea.Cmd {
+	files, err := recordings.list()
+	if err != nil {
+		a.status = styleFormError.Render(" " + err.Error())
+		return nil
+	}
+	switch key {
+	case "up", "k":
+		if a.recCursor > 0 {
+			a.recCursor--
+		}
+	case "down", "j":
+		if a.recCursor < len(files)-1 {
+			a.recCursor++
+		}
+	case "enter":
+		if a.recCursor >= len(files) {
+			return nil
+		}
+		name := files[a.recCursor].Name
+		c, err := recordings.load(name)
+		if err != nil {
+			a.status = styleFormError.Render(" " + err.Error())
+			return nil
+		}
+		a.status = ""
+		a.replay = newReplayModel(name, c)
+		return a.replay.tick()
+	case "d":
+		if a.recCursor >= len(files) {
+			return nil
+		}
+		name := files[a.recCursor].Name
+		if err := recordings.remove(name); err != nil {
+			a.status = styleFormError.Render(" " + err.Error())
+			return nil
+		}
+		a.logger.Info("Admin deleted recording", "recording", name)
+		a.status = styleItemSubtitle.Render(" Deleted " + name)
+	}
+	return nil
+}
+
+func (a *adminModel) renderRecordings() string {
+	files, err := recordings.list()
+	if err != nil {
+		return styleFormError.Render(err.Error())
+	}
+	a.recCursor = max(0, min(a.recCursor, len(files)-1))
+
+	var b strings.Builder
+	b.WriteString(styleAdminHeading.Render(fmt.Sprintf("Session recordings (%d)", len(files))))
+	b.WriteString("\n")
+	b.WriteString(styleItemSubtitle.Render("↑/↓: select • enter: replay • d: delete"))
+	b.WriteString("\n\n")
+	if !cfg.EnableRecording {
+		b.WriteString(styleItemDesc.Render("Recording is off; enable it with RECORDING_ENABLED=true."))
+		b.WriteString("\n\n")
+	}
+	for i, f := range files {
+		row := styleItemTitle.Render(f.Name) +
+			styleItemSubtitle.Render(fmt.Sprintf(" %s • %.1f KB", f.Modified.Format("Jan 2 15:04"), float64(f.Size)/1024))
+		if i == a.recCursor {
+			row = styleSelectedBorder.Render(row)
+		} else {
+			row = styleNormal.Render(row)
+		}
+		b.WriteString(row)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func orNone(list []string) string {
+	if len(list) == 0 {
+		return "none"
+	}
+	return strings.Join(list, ", ")
+}
+
+func (a *adminModel) help() string {
+	if a.form != nil {
+		return "tab: next field • ctrl+s: ban • esc: cancel"
+	}
+	if a.replay != nil {
+		return a.replay.help()
+	}
+	return "←/→: switch • tab: panel • ↑/↓: scroll • q: quit"
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	analyticsPruneTick = 6 * time.Hour
+	// How long the admin tab's summary is reused before the bucket is
+	// scanned again
+	analyticsSummaryTTL = 30 * time.Second
+	// Visit keys start with the UTC start time in this fixed-width layout,
+	// so byte order is time order
+	visitKeyLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+var (
+	bucketVisits = []byte("visits")
+	bucketMeta   = []byte("meta")
+	keySalt      = []byte("salt")
+)
+
+// visitRecord is what gets stored for one session.
+type visitRecord struct {
+	ID            string                   `json:"id"`
+	Start         time.Time                `json:"start"`
+	End           time.Time                `json:"end,omitempty"`
+	IP            string                   `json:"ip"`
+	User          string                   `json:"user"`
+	ClientVersion string                   `json:"client_version"`
+	Width         int                      `json:"width"`
+	Height        int                      `json:"height"`
+	KeyHash       string                   `json:"key_hash,omitempty"` // Salted hash of the key fingerprint
+	Dwell         map[string]time.Duration `json:"dwell"`              // Time spent per tab
+}
+
+// liveVisit tracks an open session until it ends.
+type liveVisit struct {
+	rec      visitRecord
+	tab      string
+	tabSince time.Time
+}
+
+// analyticsSummary aggregates stored visits for the admin tab.
+type analyticsSummary struct {
+	Visits      int
+	UniqueKeys  int
+	AvgDuration time.Duration
+	Dwell       map[string]time.Duration
+	Oldest      time.Time
+}
+
+// analyticsStore records visits in a bbolt database. A nil db disables it.
+type analyticsStore struct {
+	db          *bolt.DB
+	salt        []byte
+	retention   time.Duration
+	anonymizeIP bool
+
+	mu     sync.Mutex
+	live   map[string]*liveVisit
+	closed atomic.Bool // Set once the db is handed to another process
+
+	sumMu sync.Mutex
+	sum   analyticsSummary
+	sumAt time.Time // When sum was computed, zero if stale
+}
+
+var analytics = &analyticsStore{live: make(map[string]*liveVisit)}
+
+// open creates or opens the database. Retention of 0 keeps visits forever.
+func (a *analyticsStore) open(path string, retention time.Duration, anonymizeIP bool) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open analytics db %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketVisits); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		if salt := meta.Get(keySalt); salt != nil {
+			a.salt = append([]byte(nil), salt...)
+			return nil
+		}
+		a.salt = make([]byte, 32)
+		if _, err := rand.Read(a.salt); err != nil {
+			return err
+		}
+		return meta.Put(keySalt, a.salt)
+	})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to initialise analytics db: %w", err)
+	}
+	a.db = db
+	a.retention = retention
+	a.anonymizeIP = anonymizeIP
+	a.closed.Store(false)
+	return nil
+}
+
+// analyticsFromConfig opens the store unless analytics are disabled.
+func analyticsFromConfig(c config) error {
+	if !c.EnableAnalytics {
+		slog.Info("Visitor analytics disabled")
+		return nil
+	}
+	return analytics.open(c.AnalyticsPath, c.AnalyticsRetention, c.AnonymizeIPs)
+}
+
+func (a *analyticsStore) enabled() bool { return a.db != nil && !a.closed.Load() }
+
+// start records the beginning of a session.
+func (a *analyticsStore) start(info *sessionInfo, width, height int) {
+	if !a.enabled() {
+		return
+	}
+	v := &liveVisit{rec: visitRecord{
+		ID:            info.ID,
+		Start:         info.Started,
+		IP:            a.ip(info.RemoteAddr),
+		User:          info.User,
+		ClientVersion: info.ClientVersion,
+		Width:         width,
+		Height:        height,
+		Dwell:         make(map[string]time.Duration),
+	}}
+	if info.Fingerprint != "" {
+		v.rec.KeyHash = a.hashKey(info.Fingerprint)
+	}
+
+	a.mu.Lock()
+	a.live[info.ID] = v
+	rec := v.rec
+	a.mu.Unlock()
+	a.put(rec)
+}
+
+// tabViewed closes the dwell time of the previous tab and starts a new one.
+func (a *analyticsStore) tabViewed(id, tab string) {
+	if !a.enabled() {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	v, ok := a.live[id]
+	if !ok {
+		return
+	}
+	v.closeTab(time.Now())
+	v.tab = tab
+	v.tabSince = time.Now()
+}
+
+// resized keeps the largest terminal size seen during the session.
+func (a *analyticsStore) resized(id string, width, height int) {
+	if !a.enabled() {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if v, ok := a.live[id]; ok {
+		v.rec.Width = max(v.rec.Width, width)
+		v.rec.Height = max(v.rec.Height, height)
+	}
+}
+
+// end finalises and stores the session.
+func (a *analyticsStore) end(id string) {
+	if !a.enabled() {
+		return
+	}
+	a.mu.Lock()
+	v, ok := a.live[id]
+	delete(a.live, id)
+	a.mu.Unlock()
+	if !ok {
+		return
+	}
+	now := time.Now()
+	v.closeTab(now)
+	v.rec.End = now
+	a.put(v.rec)
+}
+
+func (v *liveVisit) closeTab(now time.Time) {
+	if v.tab != "" {
+		v.rec.Dwell[v.tab] += now.Sub(v.tabSince)
+	}
+}
+
+// put writes a record keyed by start time so pruning can walk in order.
+func (a *analyticsStore) put(rec visitRecord) {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		slog.Error("Failed to encode visit", "visit", rec.ID, "err", err)
+		return
+	}
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketVisits).Put(visitKey(rec), raw)
+	})
+	if err != nil {
+		slog.Error("Failed to store visit", "visit", rec.ID, "err", err)
+	}
+}
+
+func visitKey(rec visitRecord) []byte {
+	return []byte(rec.Start.UTC().Format(visitKeyLayout) + "|" + rec.ID)
+}
+
+func (a *analyticsStore) hashKey(fingerprint string) string {
+	h := sha256.New()
+	h.Write(a.salt)
+	h.Write([]byte(fingerprint))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ip returns the host part of addr, zeroing the host bits if anonymisation
+// is on (/24 for IPv4, /48 for IPv6).
+func (a *analyticsStore) ip(addr string) string {
+	host := hostOnly(addr)
+	if !a.anonymizeIP {
+		return host
+	}
+	return anonymizeIP(host)
+}
+
+func anonymizeIP(host string) string {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// close flushes the visits still open and closes the database. Later calls
+// are no-ops, which lets an upgrade release the file lock early.
+func (a *analyticsStore) close() {
+	if !a.enabled() {
+		return
+	}
+	a.mu.Lock()
+	ids := make([]string, 0, len(a.live))
+	for id := range a.live {
+		ids = append(ids, id)
+	}
+	a.mu.Unlock()
+	for _, id := range ids {
+		a.end(id)
+	}
+	a.closed.Store(true)
+	if err := a.db.Close(); err != nil {
+		slog.Error("Failed to close analytics db", "err", err)
+	}
+}
+
+// prune deletes visits older than the retention period.
+func (a *analyticsStore) prune() {
+	if !a.enabled() || a.retention <= 0 {
+		return
+	}
+	cutoff := []byte(time.Now().Add(-a.retention).UTC().Format(visitKeyLayout))
+	removed := 0
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketVisits).Cursor()
+		for k, _ := c.First(); k != nil && string(k) < string(cutoff); k, _ = c.Next() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to prune analytics", "err", err)
+		return
+	}
+	if removed > 0 {
+		a.sumMu.Lock()
+		a.sumAt = time.Time{}
+		a.sumMu.Unlock()
+		slog.Info("Pruned old visits", "removed", removed, "retention", a.retention)
+	}
+}
+
+// runPruner prunes on start and then periodically.
+func (a *analyticsStore) runPruner() {
+	for {
+		a.prune()
+		time.Sleep(analyticsPruneTick)
+	}
+}
+
+// summary aggregates every stored visit. The admin tab renders it every
+// second, so a recent result is reused rather than scanning each time.
+func (a *analyticsStore) summary() (analyticsSummary, error) {
+	if !a.enabled() {
+		return analyticsSummary{Dwell: make(map[string]time.Duration)}, nil
+	}
+	a.sumMu.Lock()
+	defer a.sumMu.Unlock()
+	if !a.sumAt.IsZero() && time.Since(a.sumAt) < analyticsSummaryTTL {
+		return a.sum, nil
+	}
+	sum, err := a.scanSummary()
+	if err != nil {
+		return sum, err
+	}
+	a.sum, a.sumAt = sum, time.Now()
+	return sum, nil
+}
+
+// scanSummary reads the whole visits bucket.
+func (a *analyticsStore) scanSummary() (analyticsSummary, error) {
+	sum := analyticsSummary{Dwell: make(map[string]time.Duration)}
+	keys := make(map[string]struct{})
+	var total time.Duration
+	var finished int
+	err := a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketVisits).ForEach(func(_, raw []byte) error {
+			var rec visitRecord
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				return nil // Skip records we can't read
+			}
+			sum.Visits++
+			if sum.Oldest.IsZero() || rec.Start.Before(sum.Oldest) {
+				sum.Oldest = rec.Start
+			}
+			if rec.KeyHash != "" {
+				keys[rec.KeyHash] = struct{}{}
+			}
+			if !rec.End.IsZero() {
+				total += rec.End.Sub(rec.Start)
+				finished++
+			}
+			for tab, d := range rec.Dwell {
+				sum.Dwell[tab] += d
+			}
+			return nil
+		})
+	})
+	sum.UniqueKeys = len(keys)
+	if finished > 0 {
+		sum.AvgDuration = total / time.Duration(finished)
+	}
+	return sum, err
+}
+
+// topTabs returns tab names ordered by total dwell time.
+func (s analyticsSummary) topTabs() []string {
+	tabs := make([]string, 0, len(s.Dwell))
+	for tab := range s.Dwell {
+		tabs = append(tabs, tab)
+	}
+	sort.Slice(tabs, func(i, j int) bool { return s.Dwell[tabs[i]] > s.Dwell[tabs[j]] })
+	return tabs
+}
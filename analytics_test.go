@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestVisitKeysSortByTime(t *testing.T) {
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	times := []time.Time{
+		base,
+		base.Add(100 * time.Millisecond),
+		base.Add(123 * time.Millisecond),
+		base.Add(time.Second),
+	}
+	for i := 1; i < len(times); i++ {
+		prev := visitKey(visitRecord{Start: times[i-1], ID: "b"})
+		next := visitKey(visitRecord{Start: times[i], ID: "a"})
+		if bytes.Compare(prev, next) >= 0 {
+			t.Errorf("key %s sorts after %s", prev, next)
+		}
+	}
+}
+
+// openTestAnalytics opens a store in a temporary directory.
+func openTestAnalytics(t *testing.T, retention time.Duration) *analyticsStore {
+	t.Helper()
+	a := &analyticsStore{live: make(map[string]*liveVisit)}
+	if err := a.open(filepath.Join(t.TempDir(), "analytics.db"), retention, false); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.db.Close() })
+	return a
+}
+
+func visitKeys(t *testing.T, a *analyticsStore) []string {
+	t.Helper()
+	var keys []string
+	err := a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketVisits).ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestAnalyticsPrune(t *testing.T) {
+	a := openTestAnalytics(t, time.Hour)
+	now := time.Now()
+	a.put(visitRecord{ID: "old", Start: now.Add(-2 * time.Hour).Truncate(time.Second).Add(100 * time.Millisecond)})
+	a.put(visitRecord{ID: "older", Start: now.Add(-3 * time.Hour).Truncate(time.Second).Add(123 * time.Millisecond)})
+	a.put(visitRecord{ID: "new", Start: now.Add(-time.Minute)})
+
+	a.prune()
+	keys := visitKeys(t, a)
+	if len(keys) != 1 || !bytes.HasSuffix([]byte(keys[0]), []byte("|new")) {
+		t.Errorf("got keys %v after pruning, want only the new visit", keys)
+	}
+}
+
+func TestAnalyticsSummaryCached(t *testing.T) {
+	a := openTestAnalytics(t, 0)
+	start := time.Now().Add(-time.Minute)
+	a.put(visitRecord{ID: "v1", Start: start, End: start.Add(30 * time.Second), KeyHash: "k"})
+
+	sum, err := a.summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Visits != 1 || sum.UniqueKeys != 1 || sum.AvgDuration != 30*time.Second {
+		t.Fatalf("got %+v", sum)
+	}
+	a.put(visitRecord{ID: "v2", Start: start})
+	if sum, _ := a.summary(); sum.Visits != 1 {
+		t.Errorf("got %d visits, want the cached 1", sum.Visits)
+	}
+	a.sumAt = time.Now().Add(-analyticsSummaryTTL)
+	if sum, _ := a.summary(); sum.Visits != 2 {
+		t.Errorf("got %d visits after the cache expired, want 2", sum.Visits)
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	ssh "github.com/charmbracelet/ssh"
+	wish "github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// How often check looks at the ban file for changes made by the CLI
+const banReloadInterval = time.Second
+
+// Heuristics that earn an address a strike towards an automatic ban
+const (
+	strikeAuth  = "auth"  // Failed handshake or authentication
+	strikeFlood = "flood" // New connection
+	strikeProbe = "probe" // Session without a PTY
+)
+
+// Where a ban came from
+const (
+	banSourceAuto  = "auto"
+	banSourceAdmin = "admin"
+	banSourceCLI   = "cli"
+)
+
+// Why a connection was refused, used as the metric label
+const (
+	blockedDeny = "deny"
+	blockedBan  = "ban"
+)
+
+var errBanNotFound = errors.New("no such ban")
+
+// --- Bans ---
+
+// ban blocks an IP or CIDR until it expires.
+type ban struct {
+	Target  string    `json:"target"`
+	Reason  string    `json:"reason"`
+	Source  string    `json:"source"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires,omitempty"` // Zero means permanent
+
+	network *net.IPNet // Target, parsed once when the ban is loaded or added
+}
+
+func (b ban) expired(now time.Time) bool {
+	return !b.Expires.IsZero() && !now.Before(b.Expires)
+}
+
+// banTarget normalises an IP or CIDR, so "10.1.2.3/8" and "10.0.0.0/8"
+// name the same ban.
+func banTarget(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	nets, err := parseCIDRs([]string{s})
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(s, "/") {
+		return nets[0].IP.String(), nil
+	}
+	return nets[0].String(), nil
+}
+
+func (b ban) matches(ip net.IP) bool {
+	return b.network != nil && b.network.Contains(ip)
+}
+
+// parsed returns b with its target parsed for matching.
+func (b ban) parsed() (ban, error) {
+	nets, err := parseCIDRs([]string{b.Target})
+	if err != nil {
+		return b, err
+	}
+	b.network = nets[0]
+	return b, nil
+}
+
+// banList checks connections against the static allow/deny lists and the
+// bans persisted in cfg.BansPath. The file is re-read when it changes, so
+// the `ban` subcommand works against a running server.
+type banList struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	checked time.Time // Last time check looked at the file
+	bans    map[string]ban
+	strikes map[string][]time.Time // "kind|ip" -> recent strikes
+}
+
+var bans = &banList{bans: make(map[string]ban), strikes: make(map[string][]time.Time)}
+
+// load reads the ban file; a missing file means no bans.
+func (b *banList) load() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reloadLocked(true)
+}
+
+func (b *banList) reloadLocked(force bool) error {
+	fi, err := os.Stat(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		b.bans = make(map[string]ban)
+		b.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat ban file: %w", err)
+	}
+	if !force && fi.ModTime().Equal(b.modTime) {
+		return nil
+	}
+	raw, err := os.ReadFile(b.path)
+	if err != nil {
+		return fmt.Errorf("failed to read ban file: %w", err)
+	}
+	var list []ban
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return fmt.Errorf("failed to parse ban file %s: %w", b.path, err)
+	}
+	b.bans = make(map[string]ban, len(list))
+	for _, entry := range list {
+		entry, err := entry.parsed()
+		if err != nil {
+			slog.Warn("Skipping invalid ban", "target", entry.Target, "err", err)
+			continue
+		}
+		b.bans[entry.Target] = entry
+	}
+	b.modTime = fi.ModTime()
+	return nil
+}
+
+// persistLocked writes the unexpired bans, oldest first.
+func (b *banList) persistLocked() error {
+	list := b.activeLocked()
+	raw, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(b.path, raw, 0600); err != nil {
+		return fmt.Errorf("failed to write ban file: %w", err)
+	}
+	if fi, err := os.Stat(b.path); err == nil {
+		b.modTime = fi.ModTime()
+	}
+	return nil
+}
+
+func (b *banList) activeLocked() []ban {
+	now := time.Now()
+	list := make([]ban, 0, len(b.bans))
+	for _, entry := range b.bans {
+		if !entry.expired(now) {
+			list = append(list, entry)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// banExempt reports whether addr is never denied, struck or banned: it is
+// in allow-cidrs or a trusted proxy. Connections a proxy makes itself, such
+// as PROXY LOCAL health checks, carry its address.
+func banExempt(addr net.IP) bool {
+	return ipInNets(addr, cfg.allowNets) || ipInNets(addr, cfg.trustedProxies)
+}
+
+// check returns why ip may not connect, or "" if it may. Exempt addresses
+// (see banExempt) skip deny-cidrs and bans; everyone else not denied or
+// banned may connect too.
+func (b *banList) check(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil || banExempt(addr) {
+		return "" // Unix socket peers have no IP
+	}
+	if ipInNets(addr, cfg.denyNets) {
+		return blockedDeny
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if now.Sub(b.checked) >= banReloadInterval {
+		b.checked = now
+		if err := b.reloadLocked(false); err != nil {
+			slog.Error("Failed to reload bans", "err", err)
+		}
+	}
+	for _, entry := range b.bans {
+		if !entry.expired(now) && entry.matches(addr) {
+			return blockedBan
+		}
+	}
+	return ""
+}
+
+// add bans target, an IP or CIDR, for d (0 means permanently).
+func (b *banList) add(target, reason, source string, d time.Duration) (ban, error) {
+	target, err := banTarget(target)
+	if err != nil {
+		return ban{}, err
+	}
+	entry, err := ban{Target: target, Reason: reason, Source: source, Created: time.Now()}.parsed()
+	if err != nil {
+		return ban{}, err
+	}
+	if d > 0 {
+		entry.Expires = entry.Created.Add(d)
+	}
+
+	err = b.update(func() error {
+		b.bans[entry.Target] = entry
+		return nil
+	})
+	if err != nil {
+		return ban{}, err
+	}
+	return entry, nil
+}
+
+// update runs fn on the bans as they are on disk and saves the result,
+// holding b.mu and the file lock, so a ban added by the CLI or by another
+// process sharing the file is never overwritten.
+func (b *banList) update(fn func() error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return withFileLock(b.path, func() error {
+		if err := b.reloadLocked(true); err != nil {
+			return err
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+		return b.persistLocked()
+	})
+}
+
+// remove lifts the ban on target.
+func (b *banList) remove(target string) error {
+	target, err := banTarget(target)
+	if err != nil {
+		return err
+	}
+	return b.update(func() error {
+		if _, ok := b.bans[target]; !ok {
+			return errBanNotFound
+		}
+		delete(b.bans, target)
+		return nil
+	})
+}
+
+// list returns the bans in force, oldest first.
+func (b *banList) list() []ban {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.reloadLocked(false); err != nil {
+		slog.Error("Failed to reload bans", "err", err)
+	}
+	return b.activeLocked()
+}
+
+// strike records one heuristic hit for ip and bans it for cfg.BanDuration
+// once it reaches the configured limit within cfg.BanWindow.
+func (b *banList) strike(ip, kind string) {
+	limit := map[string]int{
+		strikeAuth:  cfg.BanAfterAuthFailures,
+		strikeFlood: cfg.BanAfterConnections,
+		strikeProbe: cfg.BanAfterProbes,
+	}[kind]
+	addr := net.ParseIP(ip)
+	if limit <= 0 || addr == nil || banExempt(addr) {
+		return
+	}
+
+	key := kind + "|" + ip
+	now := time.Now()
+	b.mu.Lock()
+	recent := b.strikes[key][:0]
+	for _, t := range b.strikes[key] {
+		if now.Sub(t) < cfg.BanWindow {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	b.strikes[key] = recent
+	trip := len(recent) >= limit
+	if trip {
+		delete(b.strikes, key)
+	}
+	b.mu.Unlock()
+	if !trip {
+		return
+	}
+
+	reason := fmt.Sprintf("%d %s strikes in %s", limit, kind, cfg.BanWindow)
+	if _, err := b.add(ip, reason, banSourceAuto, cfg.BanDuration); err != nil {
+		slog.Error("Failed to ban", logKeyIP, ip, "err", err)
+		return
+	}
+	metricAutoBans.WithLabelValues(kind).Inc()
+	slog.Warn("Banned", logKeyIP, ip, "duration", cfg.BanDuration, "reason", reason)
+}
+
+// sweep drops expired bans and strikes that fell out of the window.
+func (b *banList) sweep() {
+	b.mu.Lock()
+	now := time.Now()
+	for key, times := range b.strikes {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= cfg.BanWindow {
+			delete(b.strikes, key)
+		}
+	}
+	expired := false
+	for _, entry := range b.bans {
+		expired = expired || entry.expired(now)
+	}
+	b.mu.Unlock()
+	if !expired {
+		return
+	}
+	// persistLocked leaves expired bans out
+	if err := b.update(func() error { return nil }); err != nil {
+		slog.Error("Failed to prune bans", "err", err)
+	}
+}
+
+func (b *banList) runSweeper() {
+	for {
+		time.Sleep(time.Minute)
+		b.sweep()
+	}
+}
+
+// kickBanned ends the live sessions that a new ban covers.
+func kickBanned(entry ban) {
+	hub.send(tea.QuitMsg{}, func(info *sessionInfo) bool {
+		ip := net.ParseIP(hostOnly(info.RemoteAddr))
+		return ip != nil && entry.matches(ip)
+	})
+}
+
+// --- Server Hooks ---
+
+// banConnCallback drops blocked addresses before the SSH handshake and
+// counts every other connection towards the flood heuristic.
+func banConnCallback(ctx ssh.Context, conn net.Conn) net.Conn {
+	ip := hostOnly(conn.RemoteAddr().String())
+	if reason := bans.check(ip); reason != "" {
+		metricBlockedConns.WithLabelValues(reason).Inc()
+		return nil
+	}
+	bans.strike(ip, strikeFlood)
+	return conn
+}
+
+// withBanHooks installs the connection and handshake failure callbacks.
+func withBanHooks() ssh.Option {
+	return func(srv *ssh.Server) error {
+		srv.ConnCallback = banConnCallback
+		srv.ConnectionFailedCallback = func(conn net.Conn, err error) {
+			if authFailed(err) {
+				bans.strike(hostOnly(conn.RemoteAddr().String()), strikeAuth)
+			}
+		}
+		return nil
+	}
+}
+
+// authFailed reports whether a handshake ended because authentication
+// failed. Clients that give up earlier, say over a rotated host key, or
+// that disconnect without trying a method, don't count.
+func authFailed(err error) bool {
+	var authErr *gossh.ServerAuthError
+	if !errors.As(err, &authErr) {
+		return false
+	}
+	for _, e := range authErr.Errors {
+		if e != nil && !errors.Is(e, gossh.ErrNoAuth) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeMiddleware counts sessions without a PTY, which real visitors never
+// open, towards the probe heuristic.
+func probeMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if _, _, ok := s.Pty(); !ok {
+				bans.strike(hostOnly(s.RemoteAddr().String()), strikeProbe)
+			}
+			next(s)
+		}
+	}
+}
+
+// --- CLI ---
+
+// runBanCommand implements `ban list|add|remove`. Settings come from the
+// environment and config file.
+func runBanCommand(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: ban list | ban add [-duration 24h] [-reason text] <ip|cidr> | ban remove <ip|cidr>")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+	if _, err := loadConfig(nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	bans.path = cfg.BansPath
+	if err := bans.load(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "list":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TARGET\tEXPIRES\tSOURCE\tREASON")
+		for _, entry := range bans.list() {
+			expires := "never"
+			if !entry.Expires.IsZero() {
+				expires = entry.Expires.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entry.Target, expires, entry.Source, entry.Reason)
+		}
+		tw.Flush()
+	case "add":
+		fs := flag.NewFlagSet("ban add", flag.ContinueOnError)
+		d := fs.Duration("duration", 0, "how long the ban lasts, 0 for permanent")
+		reason := fs.String("reason", "banned from the command line", "note stored with the ban")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			return usage()
+		}
+		entry, err := bans.add(fs.Arg(0), *reason, banSourceCLI, *d)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println("Banned", entry.Target)
+	case "remove":
+		if len(args) != 2 {
+			return usage()
+		}
+		if err := bans.remove(args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println("Unbanned", args[1])
+	default:
+		return usage()
+	}
+	return 0
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestAuthFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "key exchange aborted", err: io.EOF},
+		{name: "handshake error", err: errors.New("ssh: handshake failed: EOF")},
+		{name: "left before trying", err: &gossh.ServerAuthError{}},
+		{name: "left after none", err: &gossh.ServerAuthError{Errors: []error{gossh.ErrNoAuth}}},
+		{name: "password rejected", err: &gossh.ServerAuthError{Errors: []error{gossh.ErrNoAuth, errors.New("ssh: password auth not configured")}}, want: true},
+		{name: "wrapped", err: errors.Join(errors.New("ctx"), &gossh.ServerAuthError{Errors: []error{errors.New("denied")}}), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authFailed(tt.err); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testBans points the ban list at a temporary file with a fresh config.
+func testBans(t *testing.T) *banList {
+	t.Helper()
+	allow, _ := parseCIDRs([]string{"192.0.2.10"})
+	deny, _ := parseCIDRs([]string{"198.51.100.0/24"})
+	setTestConfig(t, config{BanWindow: time.Minute, BanAfterAuthFailures: 3, allowNets: allow, denyNets: deny})
+	return &banList{
+		path:    filepath.Join(t.TempDir(), "bans.json"),
+		bans:    make(map[string]ban),
+		strikes: make(map[string][]time.Time),
+	}
+}
+
+func TestBanCheck(t *testing.T) {
+	b := testBans(t)
+	if _, err := b.add("203.0.113.0/24", "test", banSourceCLI, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.add("192.0.2.10", "test", banSourceCLI, 0); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"203.0.113.77": blockedBan,
+		"198.51.100.1": blockedDeny,
+		"192.0.2.10":   "", // In allow-cidrs, despite the ban
+		"192.0.2.11":   "",
+		"":             "", // Unix socket peer
+	}
+	for ip, want := range tests {
+		if got := b.check(ip); got != want {
+			t.Errorf("check(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestBansReloadParsed(t *testing.T) {
+	b := testBans(t)
+	if _, err := b.add("203.0.113.5", "test", banSourceCLI, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// Another process, e.g. the CLI, reads the same file
+	other := &banList{path: b.path, bans: make(map[string]ban)}
+	if err := other.load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := other.check("203.0.113.5"); got != blockedBan {
+		t.Errorf("got %q from the reloaded list, want a ban", got)
+	}
+	if entry := other.bans["203.0.113.5"]; entry.network == nil {
+		t.Error("loaded ban was not parsed")
+	}
+}
+
+func TestBanSkipsInvalidTargets(t *testing.T) {
+	b := testBans(t)
+	raw := `[{"target":"not-an-ip","source":"cli"},{"target":"203.0.113.9","source":"cli"}]`
+	if err := os.WriteFile(b.path, []byte(raw), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.bans) != 1 || b.check("203.0.113.9") != blockedBan {
+		t.Errorf("got bans %v", b.bans)
+	}
+}
+
+func TestStrikeBansAtLimit(t *testing.T) {
+	b := testBans(t)
+	for i := range 3 {
+		if got := b.check("203.0.113.20"); got != "" {
+			t.Fatalf("banned after %d strikes", i)
+		}
+		b.strike("203.0.113.20", strikeAuth)
+	}
+	b.checked = time.Time{}
+	if got := b.check("203.0.113.20"); got != blockedBan {
+		t.Errorf("got %q after 3 strikes, want a ban", got)
+	}
+	// Allowed addresses never collect strikes
+	for range 5 {
+		b.strike("192.0.2.10", strikeAuth)
+	}
+	if len(b.strikes) != 0 {
+		t.Errorf("got strikes %v for an allowed address", b.strikes)
+	}
+}
+
+func TestBansMergeConcurrentWriters(t *testing.T) {
+	oldProc := testBans(t)
+	newProc := &banList{path: oldProc.path, bans: make(map[string]ban), strikes: make(map[string][]time.Time)}
+
+	if _, err := newProc.add("203.0.113.1", "new", banSourceCLI, 0); err != nil {
+		t.Fatal(err)
+	}
+	// The old process hasn't looked at the file since, but must not drop it
+	if _, err := oldProc.add("203.0.113.2", "old", banSourceAdmin, 0); err != nil {
+		t.Fatal(err)
+	}
+	check := &banList{path: oldProc.path, bans: make(map[string]ban)}
+	if err := check.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(check.bans) != 2 {
+		t.Errorf("got bans %v, want both", check.bans)
+	}
+	if err := oldProc.remove("203.0.113.1"); err != nil {
+		t.Errorf("removing a ban added elsewhere: %v", err)
+	}
+}
+
+func TestTrustedProxyNeverStruck(t *testing.T) {
+	saved := bans
+	t.Cleanup(func() { bans = saved })
+	bans = testBans(t)
+	trusted, _ := parseCIDRs([]string{"127.0.0.0/8"})
+	cfg.trustedProxies = trusted
+	cfg.BanAfterConnections = 3
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newProxyListener(ln, trusted)
+	defer l.Close()
+
+	// The load balancer's own health checks come in as LOCAL and UNKNOWN
+	for i := range 5 {
+		header := string(proxyV2(0x20, 0x00, nil))
+		if i%2 == 1 {
+			header = "PROXY UNKNOWN\r\n"
+		}
+		if banConnCallback(nil, dialThrough(t, l, header)) == nil {
+			t.Fatalf("health check %d was dropped", i+1)
+		}
+	}
+	if len(bans.strikes) != 0 || len(bans.bans) != 0 {
+		t.Errorf("got strikes %v, bans %v for the proxy", bans.strikes, bans.bans)
+	}
+	if got := bans.check("127.0.0.1"); got != "" {
+		t.Errorf("got %q for the proxy", got)
+	}
+
+	// Visitors behind it are still counted
+	for range 3 {
+		banConnCallback(nil, dialThrough(t, l, "PROXY TCP4 203.0.113.7 10.0.0.1 51234 22\r\n"))
+	}
+	bans.checked = time.Time{}
+	if banConnCallback(nil, dialThrough(t, l, "PROXY TCP4 203.0.113.7 10.0.0.1 51235 22\r\n")) != nil {
+		t.Error("a flooding visitor behind the proxy was not banned")
+	}
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultDataDir    = "/data"
+	defaultConfigPath = defaultDataDir + "/config.json"
+	defaultListenAddr = ":22" // Every interface, IPv4 and IPv6
+	devListenAddr     = ":23234"
+)
+
+// Where a setting's effective value came from, lowest precedence first
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// --- Configuration ---
+
+// config holds every runtime setting. It is filled in layers: defaults,
+// then the config file, then environment variables, then CLI flags.
+type config struct {
+	ListenAddrs []string // host:port or unix:/path, see parseListenAddr
+	HealthAddr  string   // Empty disables the health endpoints
+	MetricsAddr string   // Empty disables /metrics
+
+	PublicHost string // Name (and port) visitors connect to, for known_hosts and SSHFP
+
+	ProxyProtocol  bool
+	TrustedProxies []string     // CIDRs allowed to send PROXY headers
+	trustedProxies []*net.IPNet // Parsed from TrustedProxies
+
+	AllowCIDRs []string // Exempt from DenyCIDRs and bans; not an allowlist
+	DenyCIDRs  []string
+	allowNets  []*net.IPNet
+	denyNets   []*net.IPNet
+
+	DataDir       string
+	HostKeyPath   string // Paths left empty are derived from DataDir
+	AdminKeysPath string
+	ContentPath   string
+	GuestbookPath string
+	OutboxDir     string
+	AnalyticsPath string
+	BansPath      string
+	RecordingsDir string
+
+	HostKeyData     string // PEM or base64; replaces the keys in the data dir
+	HostKeyFile     string
+	SecretsProvider string
+	HostKeyTypes    []string
+	HostKeyGrace    time.Duration
+	HostCerts       []string
+
+	Theme string
+
+	LogLevel    string // debug, info, warn or error
+	LogFormat   string // text or json
+	PrivacyMode bool   // Redact client IPs in logs and analytics
+
+	SplashDuration  time.Duration
+	DrainPeriod     time.Duration
+	ShutdownTimeout time.Duration
+
+	UpgradeDrainTimeout time.Duration
+
+	IdleTimeout        time.Duration
+	MaxSessionDuration time.Duration
+	TimeoutWarning     time.Duration
+
+	RateLimitPerMinute int
+	RateLimitBurst     int
+	MaxSessionsPerIP   int
+	MaxSessions        int
+
+	BanDuration          time.Duration
+	BanWindow            time.Duration
+	BanAfterAuthFailures int
+	BanAfterConnections  int
+	BanAfterProbes       int
+
+	GuestbookCooldown time.Duration
+	ContactCooldown   time.Duration
+
+	EnableAdmin       bool
+	EnableGuestbook   bool
+	EnableContactForm bool
+	EnableAnalytics   bool
+
+	AnalyticsRetention time.Duration
+	AnonymizeIPs       bool
+
+	EnableRecording        bool
+	RecordingSamplePercent int
+	RecordingRetention     time.Duration
+	RecordingMaxBytes      int
+
+	EnableLounge        bool
+	LoungeHistory       int
+	LoungeRatePerMinute int
+	LoungeBlockedWords  []string
+
+	ContactWebhookURL string
+	SMTPAddr          string
+	SMTPUser          string
+	SMTPPass          string
+	MailFrom          string
+	MailTo            string
+}
+
+// cfg is the effective configuration, set by loadConfig at startup.
+var cfg config
+
+// setting describes one configurable value. Its name is both the flag and
+// the config file key.
+type setting struct {
+	name   string
+	env    string
+	secret bool // Hidden by `config print`
+	source string
+}
+
+type configLoader struct {
+	fs         *flag.FlagSet
+	settings   []*setting
+	byName     map[string]*setting
+	configPath string
+}
+
+func newConfigLoader(c *config) *configLoader {
+	l := &configLoader{
+		fs:     flag.NewFlagSet("portfolio", flag.ContinueOnError),
+		byName: make(map[string]*setting),
+	}
+	l.fs.StringVar(&l.configPath, "config", "", "config file (JSON), default "+defaultConfigPath+" or $CONFIG_FILE")
+
+	listen := defaultListenAddr
+	if os.Getenv("DEV_MODE") != "" {
+		listen = devListenAddr // Kept for compatibility with older deployments
+	}
+	l.list(&c.ListenAddrs, "listen-addr", "LISTEN_ADDR", listen, "comma-separated addresses to serve SSH on (host:port or unix:/path)")
+	l.str(&c.HealthAddr, "health-addr", "HEALTH_ADDR", "127.0.0.1:8080", "address for /healthz and /readyz, empty or off to disable")
+	l.str(&c.MetricsAddr, "metrics-addr", "METRICS_ADDR", "", "address for Prometheus /metrics, empty to disable")
+	l.str(&c.PublicHost, "public-host", "PUBLIC_HOST", "", "host[:port] visitors connect to, used in known_hosts and SSHFP output (default hostname and listen port)")
+	l.boolean(&c.ProxyProtocol, "proxy-protocol", "PROXY_PROTOCOL", false, "read PROXY protocol v1/v2 headers from trusted proxies")
+	l.list(&c.TrustedProxies, "trusted-proxies", "TRUSTED_PROXIES", "", "comma-separated CIDRs of load balancers allowed to send PROXY headers; never banned")
+	l.list(&c.AllowCIDRs, "allow-cidrs", "ALLOW_CIDRS", "", "comma-separated CIDRs exempt from deny-cidrs and bans; not an allowlist, other addresses can still connect")
+	l.list(&c.DenyCIDRs, "deny-cidrs", "DENY_CIDRS", "", "comma-separated CIDRs refused before the SSH handshake")
+
+	l.str(&c.DataDir, "data-dir", "DATA_DIR", defaultDataDir, "directory for keys and persistent data")
+	l.str(&c.HostKeyPath, "host-key", "HOST_KEY_PATH", "", "ed25519 host key; other types sit next to it (default <data-dir>/ssh_host_ed25519_key)")
+	l.str(&c.HostKeyData, "host-key-data", "HOST_KEY", "", "host keys as PEM or base64-encoded PEM, used instead of the data dir")
+	l.byName["host-key-data"].secret = true
+	l.str(&c.HostKeyFile, "host-key-file", "HOST_KEY_FILE", "", "read-only file of PEM host keys, e.g. a mounted secret, used instead of the data dir")
+	l.str(&c.SecretsProvider, "secrets-provider", "SECRETS_PROVIDER", "", "where to look up ssh_host_<type>_key secrets, e.g. file:/run/secrets")
+	l.list(&c.HostKeyTypes, "host-key-types", "HOST_KEY_TYPES", strings.Join(hostKeyTypes, ","), "comma-separated host key types to serve: "+strings.Join(hostKeyTypes, ", "))
+	l.list(&c.HostCerts, "host-certs", "HOST_CERTS", "", "comma-separated OpenSSH host certificates to present (default <host key>-cert.pub where present)")
+	l.dur(&c.HostKeyGrace, "host-key-grace", "HOST_KEY_GRACE", 7*24*time.Hour, "how long `hostkey rotate` keeps presenting the old keys")
+	l.str(&c.AdminKeysPath, "admin-keys", "ADMIN_KEYS_PATH", "", "authorized_keys file for the owner (default <data-dir>/authorized_keys)")
+	l.str(&c.ContentPath, "content-file", "CONTENT_PATH", "", "résumé content file (default <data-dir>/resume.json)")
+	l.str(&c.GuestbookPath, "guestbook-file", "GUESTBOOK_PATH", "", "guestbook file (default <data-dir>/guestbook.json)")
+	l.str(&c.OutboxDir, "outbox-dir", "OUTBOX_DIR", "", "contact message queue (default <data-dir>/outbox)")
+	l.str(&c.AnalyticsPath, "analytics-db", "ANALYTICS_PATH", "", "analytics database (default <data-dir>/analytics.db)")
+	l.str(&c.BansPath, "bans-file", "BANS_PATH", "", "active bans (default <data-dir>/bans.json)")
+	l.str(&c.RecordingsDir, "recordings-dir", "RECORDINGS_DIR", "", "session recordings (default <data-dir>/recordings)")
+
+	l.str(&c.Theme, "theme", "THEME", "green", "colour theme: "+strings.Join(themeNames(), ", "))
+
+	l.str(&c.LogLevel, "log-level", "LOG_LEVEL", "info", "minimum log level: debug, info, warn or error")
+	l.str(&c.LogFormat, "log-format", "LOG_FORMAT", "text", "log output format: "+strings.Join(logFormats, ", "))
+	l.boolean(&c.PrivacyMode, "privacy-mode", "PRIVACY_MODE", false, "redact client IPs in logs and store only their network part")
+
+	l.dur(&c.SplashDuration, "splash-duration", "SPLASH_DURATION", 3*time.Second, "how long the splash screen shows")
+	l.dur(&c.DrainPeriod, "drain-period", "DRAIN_PERIOD", 5*time.Second, "how long sessions get to finish on shutdown")
+	l.dur(&c.ShutdownTimeout, "shutdown-timeout", "SHUTDOWN_TIMEOUT", 5*time.Second, "grace period for closing connections after draining")
+	l.dur(&c.UpgradeDrainTimeout, "upgrade-drain-timeout", "UPGRADE_DRAIN_TIMEOUT", time.Hour, "how long sessions may stay on the old process after an upgrade, 0 for no limit")
+
+	l.dur(&c.IdleTimeout, "idle-timeout", "IDLE_TIMEOUT", 15*time.Minute, "close sessions without input for this long, 0 to disable")
+	l.dur(&c.MaxSessionDuration, "max-session-duration", "MAX_SESSION_DURATION", 2*time.Hour, "close sessions after this long, 0 to disable")
+	l.dur(&c.TimeoutWarning, "timeout-warning", "TIMEOUT_WARNING", time.Minute, "how long before a timeout the countdown appears")
+
+	l.integer(&c.RateLimitPerMinute, "rate-limit-per-minute", "RATE_LIMIT_PER_MINUTE", 10, "new sessions allowed per IP per minute, 0 for no limit")
+	l.integer(&c.RateLimitBurst, "rate-limit-burst", "RATE_LIMIT_BURST", 5, "sessions an IP may open in a quick burst")
+	l.integer(&c.MaxSessionsPerIP, "max-sessions-per-ip", "MAX_SESSIONS_PER_IP", 3, "concurrent sessions per IP, 0 for no limit")
+	l.integer(&c.MaxSessions, "max-sessions", "MAX_SESSIONS", 200, "concurrent sessions in total, 0 for no limit")
+
+	l.dur(&c.BanDuration, "ban-duration", "BAN_DURATION", time.Hour, "how long automatic bans last, 0 for permanent")
+	l.dur(&c.BanWindow, "ban-window", "BAN_WINDOW", 10*time.Minute, "window the automatic ban thresholds are counted over")
+	l.integer(&c.BanAfterAuthFailures, "ban-after-auth-failures", "BAN_AFTER_AUTH_FAILURES", 10, "failed handshakes before an IP is banned, 0 to disable")
+	l.integer(&c.BanAfterConnections, "ban-after-connections", "BAN_AFTER_CONNECTIONS", 120, "connections before an IP is banned as a flood, 0 to disable")
+	l.integer(&c.BanAfterProbes, "ban-after-probes", "BAN_AFTER_PROBES", 10, "sessions without a PTY before an IP is banned, 0 to disable")
+
+	l.dur(&c.GuestbookCooldown, "guestbook-cooldown", "GUESTBOOK_COOLDOWN", 10*time.Minute, "minimum time between guestbook messages per visitor")
+	l.dur(&c.ContactCooldown, "contact-cooldown", "CONTACT_COOLDOWN", 5*time.Minute, "minimum time between contact messages per visitor")
+
+	l.boolean(&c.EnableAdmin, "enable-admin", "ADMIN_ENABLED", true, "enable the owner-only admin tab")
+	l.boolean(&c.EnableGuestbook, "enable-guestbook", "GUESTBOOK_ENABLED", true, "enable the guestbook tab")
+	l.boolean(&c.EnableContactForm, "enable-contact-form", "CONTACT_FORM_ENABLED", true, "enable the contact form")
+	l.boolean(&c.EnableAnalytics, "enable-analytics", "ANALYTICS_ENABLED", true, "record visits in the analytics store")
+
+	l.dur(&c.AnalyticsRetention, "analytics-retention", "ANALYTICS_RETENTION", 90*24*time.Hour, "how long to keep visits, 0 keeps them forever")
+	l.boolean(&c.AnonymizeIPs, "anonymize-ips", "ANALYTICS_ANONYMIZE_IPS", false, "store only the network part of visitor IPs")
+
+	l.boolean(&c.EnableRecording, "enable-recording", "RECORDING_ENABLED", false, "record a sample of visitor sessions as asciicast v2 files")
+	l.integer(&c.RecordingSamplePercent, "recording-sample-percent", "RECORDING_SAMPLE_PERCENT", 10, "percentage of visitor sessions to record")
+	l.dur(&c.RecordingRetention, "recording-retention", "RECORDING_RETENTION", 7*24*time.Hour, "how long to keep recordings, 0 keeps them forever")
+	l.integer(&c.RecordingMaxBytes, "recording-max-bytes", "RECORDING_MAX_BYTES", 10<<20, "stop recording a session once its file reaches this size, 0 for no limit")
+
+	l.boolean(&c.EnableLounge, "enable-lounge", "LOUNGE_ENABLED", false, "enable the lounge tab, a live chat between visitors")
+	l.integer(&c.LoungeHistory, "lounge-history", "LOUNGE_HISTORY", 100, "lounge messages kept for newcomers")
+	l.integer(&c.LoungeRatePerMinute, "lounge-rate-limit", "LOUNGE_RATE_LIMIT", 6, "lounge messages and nick changes allowed per visitor and IP per minute, 0 for no limit")
+	l.list(&c.LoungeBlockedWords, "lounge-blocked-words", "LOUNGE_BLOCKED_WORDS", "", "comma-separated words masked in lounge messages and nicknames")
+
+	l.str(&c.ContactWebhookURL, "contact-webhook-url", "CONTACT_WEBHOOK_URL", "", "deliver contact messages by POSTing JSON here")
+	l.byName["contact-webhook-url"].secret = true
+	l.str(&c.SMTPAddr, "smtp-addr", "CONTACT_SMTP_ADDR", "", "deliver contact messages through this SMTP server (host:port)")
+	l.str(&c.SMTPUser, "smtp-user", "CONTACT_SMTP_USER", "", "SMTP username")
+	l.str(&c.SMTPPass, "smtp-pass", "CONTACT_SMTP_PASS", "", "SMTP password")
+	l.byName["smtp-pass"].secret = true
+	l.str(&c.MailFrom, "mail-from", "CONTACT_MAIL_FROM", "", "sender address for contact emails")
+	l.str(&c.MailTo, "mail-to", "CONTACT_MAIL_TO", "", "recipient address for contact emails")
+	return l
+}
+
+func (l *configLoader) add(name, env string) {
+	s := &setting{name: name, env: env, source: sourceDefault}
+	l.settings = append(l.settings, s)
+	l.byName[name] = s
+}
+
+func (l *configLoader) str(p *string, name, env, def, usage string) {
+	l.fs.StringVar(p, name, def, usage+" ($"+env+")")
+	l.add(name, env)
+}
+
+func (l *configLoader) list(p *[]string, name, env, def, usage string) {
+	v := (*stringList)(p)
+	_ = v.Set(def)
+	l.fs.Var(v, name, usage+" ($"+env+")")
+	l.add(name, env)
+}
+
+func (l *configLoader) dur(p *time.Duration, name, env string, def time.Duration, usage string) {
+	l.fs.DurationVar(p, name, def, usage+" ($"+env+")")
+	l.add(name, env)
+}
+
+func (l *configLoader) integer(p *int, name, env string, def int, usage string) {
+	l.fs.IntVar(p, name, def, usage+" ($"+env+")")
+	l.add(name, env)
+}
+
+func (l *configLoader) boolean(p *bool, name, env string, def bool, usage string) {
+	l.fs.BoolVar(p, name, def, usage+" ($"+env+")")
+	l.add(name, env)
+}
+
+// load applies the config file, environment and args on top of the defaults.
+func (l *configLoader) load(args []string) error {
+	// Parse flags first to find -config, then re-apply them last so they win
+	if err := l.fs.Parse(args); err != nil {
+		return err
+	}
+	if l.fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", l.fs.Arg(0))
+	}
+	flags := make(map[string]string)
+	l.fs.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+
+	if err := l.loadFile(); err != nil {
+		return err
+	}
+	for _, s := range l.settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := l.set(s, v, sourceEnv); err != nil {
+				return err
+			}
+		}
+	}
+	for name, v := range flags {
+		if s, ok := l.byName[name]; ok {
+			if err := l.set(s, v, sourceFlag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *configLoader) set(s *setting, v, source string) error {
+	if err := l.fs.Set(s.name, v); err != nil {
+		return fmt.Errorf("invalid %s from %s: %w", s.name, source, err)
+	}
+	s.source = source
+	return nil
+}
+
+// loadFile reads the JSON config file. The default path may be missing;
+// one named explicitly must exist.
+func (l *configLoader) loadFile() error {
+	path, explicit := l.configPath, true
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		path, explicit = defaultConfigPath, false
+	}
+	l.configPath = path
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		l.configPath = ""
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	for key, value := range values {
+		s, ok := l.byName[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %q in %s", key, path)
+		}
+		v, err := fileValueString(value)
+		if err != nil {
+			return fmt.Errorf("setting %q in %s: %w", key, path, err)
+		}
+		if err := l.set(s, v, sourceFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stringList is a comma-separated flag value. Set replaces the whole list,
+// so a later layer overrides an earlier one instead of adding to it.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = nil
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*s = append(*s, part)
+		}
+	}
+	return nil
+}
+
+// fileValueString turns a decoded JSON value into flag syntax.
+func fileValueString(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, err := fileValueString(item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// dataPath is a path setting that defaults to a file inside the data dir.
+type dataPath struct {
+	setting string
+	value   *string
+	file    string
+}
+
+// dataPaths lists c's path settings that default to the data dir, for
+// finish and `config print`.
+func (c *config) dataPaths() []dataPath {
+	return []dataPath{
+		{"host-key", &c.HostKeyPath, "ssh_host_ed25519_key"},
+		{"admin-keys", &c.AdminKeysPath, "authorized_keys"},
+		{"content-file", &c.ContentPath, "resume.json"},
+		{"guestbook-file", &c.GuestbookPath, "guestbook.json"},
+		{"outbox-dir", &c.OutboxDir, "outbox"},
+		{"analytics-db", &c.AnalyticsPath, "analytics.db"},
+		{"bans-file", &c.BansPath, "bans.json"},
+		{"recordings-dir", &c.RecordingsDir, "recordings"},
+	}
+}
+
+// finish derives the data paths left empty and validates the result.
+func (c *config) finish() error {
+	for _, p := range c.dataPaths() {
+		if *p.value == "" {
+			*p.value = filepath.Join(c.DataDir, p.file)
+		}
+	}
+	for _, addr := range []*string{&c.HealthAddr, &c.MetricsAddr} {
+		if *addr == "off" {
+			*addr = "" // Older deployments used HEALTH_ADDR=off
+		}
+	}
+
+	if len(c.ListenAddrs) == 0 {
+		return errors.New("listen-addr must name at least one address")
+	}
+	for _, addr := range c.ListenAddrs {
+		if _, _, err := parseListenAddr(addr); err != nil {
+			return err
+		}
+	}
+	for name, n := range map[string]int{
+		"rate-limit-per-minute":   c.RateLimitPerMinute,
+		"rate-limit-burst":        c.RateLimitBurst,
+		"max-sessions-per-ip":     c.MaxSessionsPerIP,
+		"max-sessions":            c.MaxSessions,
+		"ban-after-auth-failures": c.BanAfterAuthFailures,
+		"ban-after-connections":   c.BanAfterConnections,
+		"ban-after-probes":        c.BanAfterProbes,
+		"recording-max-bytes":     c.RecordingMaxBytes,
+		"lounge-rate-limit":       c.LoungeRatePerMinute,
+	} {
+		if n < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if c.RecordingSamplePercent < 0 || c.RecordingSamplePercent > 100 {
+		return errors.New("recording-sample-percent must be between 0 and 100")
+	}
+	if c.LoungeHistory < 1 {
+		return errors.New("lounge-history must be at least 1")
+	}
+	if c.RateLimitPerMinute > 0 && c.RateLimitBurst < 1 {
+		return errors.New("rate-limit-burst must be at least 1 when rate-limit-per-minute is set")
+	}
+	nets, err := parseCIDRs(c.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("trusted-proxies: %w", err)
+	}
+	c.trustedProxies = nets
+	if c.ProxyProtocol && len(nets) == 0 {
+		return errors.New("proxy-protocol needs trusted-proxies, otherwise any client could spoof its address")
+	}
+	if len(c.HostKeyTypes) == 0 {
+		return errors.New("host-key-types must name at least one type")
+	}
+	for _, typ := range c.HostKeyTypes {
+		if !slices.Contains(hostKeyTypes, typ) {
+			return fmt.Errorf("unknown host key type %q (choose from %s)", typ, strings.Join(hostKeyTypes, ", "))
+		}
+	}
+	if c.SecretsProvider != "" {
+		if _, err := newSecretsProvider(c.SecretsProvider); err != nil {
+			return fmt.Errorf("secrets-provider: %w", err)
+		}
+	}
+	if c.allowNets, err = parseCIDRs(c.AllowCIDRs); err != nil {
+		return fmt.Errorf("allow-cidrs: %w", err)
+	}
+	if c.denyNets, err = parseCIDRs(c.DenyCIDRs); err != nil {
+		return fmt.Errorf("deny-cidrs: %w", err)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("unknown log level %q (choose from debug, info, warn, error)", c.LogLevel)
+	}
+	if !slices.Contains(logFormats, c.LogFormat) {
+		return fmt.Errorf("unknown log format %q (choose from %s)", c.LogFormat, strings.Join(logFormats, ", "))
+	}
+	if c.PrivacyMode {
+		c.AnonymizeIPs = true
+	}
+	if _, ok := themes[c.Theme]; !ok {
+		return fmt.Errorf("unknown theme %q (choose from %s)", c.Theme, strings.Join(themeNames(), ", "))
+	}
+	if c.SMTPAddr != "" && (c.MailFrom == "" || c.MailTo == "") {
+		return errors.New("mail-from and mail-to are required with smtp-addr")
+	}
+	for name, d := range map[string]time.Duration{
+		"splash-duration":       c.SplashDuration,
+		"drain-period":          c.DrainPeriod,
+		"shutdown-timeout":      c.ShutdownTimeout,
+		"upgrade-drain-timeout": c.UpgradeDrainTimeout,
+		"idle-timeout":          c.IdleTimeout,
+		"max-session-duration":  c.MaxSessionDuration,
+		"timeout-warning":       c.TimeoutWarning,
+		"analytics-retention":   c.AnalyticsRetention,
+		"recording-retention":   c.RecordingRetention,
+		"host-key-grace":        c.HostKeyGrace,
+		"ban-duration":          c.BanDuration,
+		"ban-window":            c.BanWindow,
+	} {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// loadConfig builds the effective configuration from args and the
+// environment, returning the loader so callers can report sources.
+func loadConfig(args []string) (*configLoader, error) {
+	var c config
+	l := newConfigLoader(&c)
+	if err := l.load(args); err != nil {
+		return nil, err
+	}
+	if err := c.finish(); err != nil {
+		return nil, err
+	}
+	cfg = c
+	return l, nil
+}
+
+// print writes every setting with its effective value and source.
+func (l *configLoader) print(w io.Writer) {
+	if l.configPath != "" {
+		fmt.Fprintf(w, "# config file: %s\n", l.configPath)
+	} else {
+		fmt.Fprintf(w, "# config file: none (%s not found)\n", defaultConfigPath)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE\tENV")
+	for _, s := range l.settings {
+		value := l.fs.Lookup(s.name).Value.String()
+		if derived := derivedPath(s.name); derived != nil && s.source == sourceDefault {
+			value = *derived
+		}
+		if s.secret && value != "" {
+			value = "********"
+		}
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.name, value, s.source, s.env)
+	}
+	tw.Flush()
+}
+
+// derivedPath returns the resolved value of the path settings that default
+// to a location inside the data dir.
+func derivedPath(name string) *string {
+	for _, p := range cfg.dataPaths() {
+		if p.setting == name {
+			return p.value
+		}
+	}
+	return nil
+}
+
+// runConfigCommand implements `config print`.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: config print [flags]")
+		return 2
+	}
+	l, err := loadConfig(args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	l.print(os.Stdout)
+	return 0
+}
+
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// contentReloadedMsg tells every session to pick up freshly saved content.
+type contentReloadedMsg struct{}
+
+// resumeFile is the on-disk layout of the résumé content.
+type resumeFile struct {
+	Education  []educationItem  `json:"education"`
+	Experience []experienceItem `json:"experience"`
+	Projects   []projectItem    `json:"projects"`
+	Skills     []skillsItem     `json:"skills"`
+	Contact    []contactItem    `json:"contact"`
+}
+
+// resumeFileKeys maps the content file's keys to the sections they hold.
+var resumeFileKeys = map[string]string{
+	"education":  "Education",
+	"experience": "Experience",
+	"projects":   "Projects",
+	"skills":     "Skills & Interests",
+	"contact":    "Contact",
+}
+
+func (f resumeFile) sections() map[string][]listItemData {
+	out := make(map[string][]listItemData, len(sectionOrder))
+	for _, it := range f.Education {
+		out["Education"] = append(out["Education"], it)
+	}
+	for _, it := range f.Experience {
+		out["Experience"] = append(out["Experience"], it)
+	}
+	for _, it := range f.Projects {
+		out["Projects"] = append(out["Projects"], it)
+	}
+	for _, it := range f.Skills {
+		out["Skills & Interests"] = append(out["Skills & Interests"], it)
+	}
+	for _, it := range f.Contact {
+		out["Contact"] = append(out["Contact"], it)
+	}
+	return out
+}
+
+func resumeFileFrom(data map[string][]listItemData) resumeFile {
+	var f resumeFile
+	for _, items := range data {
+		for _, it := range items {
+			switch d := it.(type) {
+			case educationItem:
+				f.Education = append(f.Education, d)
+			case experienceItem:
+				f.Experience = append(f.Experience, d)
+			case projectItem:
+				f.Projects = append(f.Projects, d)
+			case skillsItem:
+				f.Skills = append(f.Skills, d)
+			case contactItem:
+				f.Contact = append(f.Contact, d)
+			}
+		}
+	}
+	return f
+}
+
+// --- Content Store ---
+
+// contentStore holds the résumé served to every session. Sessions keep their
+// own snapshot and refresh it when a contentReloadedMsg arrives.
+type contentStore struct {
+	path string
+	mu   sync.RWMutex
+	data map[string][]listItemData
+}
+
+var content = &contentStore{data: resumeData} // path is set from cfg.ContentPath
+
+// load reads the content file, keeping the built-in résumé if there is none.
+func (c *contentStore) load() error {
+	data, err := c.read()
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		slog.Info("No content file, using built-in résumé", "path", c.path)
+		return nil
+	}
+	c.mu.Lock()
+	c.data = data
+	c.mu.Unlock()
+	slog.Info("Loaded résumé content", "path", c.path)
+	return nil
+}
+
+// read parses the content file, returning nil if there is none.
+func (c *contentStore) read() (map[string][]listItemData, error) {
+	raw, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content file: %w", err)
+	}
+	var f resumeFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse content file %s: %w", c.path, err)
+	}
+	data := f.sections()
+
+	// A section left out of the file, e.g. one written by hand, keeps the
+	// built-in content rather than showing up empty
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse content file %s: %w", c.path, err)
+	}
+	for key, section := range resumeFileKeys {
+		if _, ok := keys[key]; !ok {
+			slog.Warn("Content file has no section, using the built-in one", "section", section, "key", key, "path", c.path)
+			data[section] = resumeData[section]
+		}
+	}
+	return data, nil
+}
+
+// snapshot returns a copy of the section slices safe to hand to one session.
+// Items themselves are treated as immutable and shared.
+func (c *contentStore) snapshot() map[string][]listItemData {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[string][]listItemData, len(c.data))
+	for section, items := range c.data {
+		out[section] = append([]listItemData(nil), items...)
+	}
+	return out
+}
+
+// saveSection replaces one section, writes the whole résumé to disk and
+// tells every session to reload. The other sections are re-read under the
+// file lock first, so edits saved by another process, such as the one
+// taking over during an upgrade, are kept.
+func (c *contentStore) saveSection(section string, items []listItemData) error {
+	c.mu.Lock()
+	err := withFileLock(c.path, func() error {
+		current, err := c.read()
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			current = c.data
+		}
+		next := make(map[string][]listItemData, len(current))
+		for s, its := range current {
+			next[s] = its
+		}
+		next[section] = append([]listItemData(nil), items...)
+
+		raw, err := json.MarshalIndent(resumeFileFrom(next), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode content: %w", err)
+		}
+		if err := writeFileAtomic(c.path, append(raw, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write content file: %w", err)
+		}
+		c.data = next
+		return nil
+	})
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Saved section", "section", section, "path", c.path)
+	hub.broadcast(contentReloadedMsg{})
+	return nil
+}
+
+// withFileLock runs fn holding an exclusive lock next to path, so processes
+// sharing the data dir, like the two running during an upgrade, take turns
+// to read, change and write the file.
+func withFileLock(path string, fn func() error) error {
+	dir, name := filepath.Split(path)
+	f, err := os.OpenFile(filepath.Join(dir, "."+name+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open lock for %s: %w", name, err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", name, err)
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it into
+// place, so readers never see a half-written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveSectionKeepsOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.json")
+	oldProc := &contentStore{path: path, data: resumeData}
+	newProc := &contentStore{path: path, data: resumeData}
+
+	skills := []listItemData{skillsItem{Category: "Languages", Details: []string{"Go"}}}
+	if err := newProc.saveSection("Skills & Interests", skills); err != nil {
+		t.Fatal(err)
+	}
+	contact := []listItemData{contactItem{Line: "hello@example.com"}}
+	if err := oldProc.saveSection("Contact", contact); err != nil {
+		t.Fatal(err)
+	}
+
+	check := &contentStore{path: path}
+	if err := check.load(); err != nil {
+		t.Fatal(err)
+	}
+	got := check.snapshot()
+	if s, ok := got["Skills & Interests"][0].(skillsItem); !ok || len(s.Details) != 1 || s.Details[0] != "Go" {
+		t.Errorf("lost the other process's edit: %#v", got["Skills & Interests"])
+	}
+	if c, ok := got["Contact"][0].(contactItem); !ok || c.Line != "hello@example.com" {
+		t.Errorf("got contact %#v", got["Contact"])
+	}
+}
+
+func TestLoadKeepsMissingSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.json")
+	if err := os.WriteFile(path, []byte(`{"contact": [], "skills": [{"category": "Languages", "details": ["Go"]}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := &contentStore{path: path}
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	got := c.snapshot()
+	if len(got["Contact"]) != 0 {
+		t.Errorf("an empty section in the file got %d entries", len(got["Contact"]))
+	}
+	if len(got["Skills & Interests"]) != 1 {
+		t.Errorf("got %d skills, want the file's one", len(got["Skills & Interests"]))
+	}
+	if len(got["Experience"]) == 0 || len(got["Experience"]) != len(resumeData["Experience"]) {
+		t.Errorf("a section missing from the file got %d entries, want the built-in ones", len(got["Experience"]))
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --- Résumé Editor ---
+
+// editorFields lists the form inputs for an item of each section, in the
+// order itemValues and itemFromValues use.
+var editorFields = map[string][]fieldSpec{
+	"Education": {
+		{Label: "School", Required: true, MaxLen: 80},
+		{Label: "Status", MaxLen: 40},
+		{Label: "Dates", MaxLen: 40},
+		{Label: "Details (one per line)", Multi: true, MaxLen: 1000, MaxLines: 10},
+	},
+	"Experience": {
+		{Label: "Company", Required: true, MaxLen: 80},
+		{Label: "Role", Required: true, MaxLen: 80},
+		{Label: "Dates", MaxLen: 40},
+		{Label: "Location", MaxLen: 60},
+		{Label: "Reporting", MaxLen: 120},
+		{Label: "Description (one bullet per line)", Multi: true, MaxLen: 2000, MaxLines: 10},
+	},
+	"Projects": {
+		{Label: "Name", Required: true, MaxLen: 80},
+		{Label: "Dates", MaxLen: 40},
+		{Label: "Description (one bullet per line)", Multi: true, MaxLen: 2000, MaxLines: 10},
+	},
+	"Skills & Interests": {
+		{Label: "Category", Required: true, MaxLen: 60},
+		{Label: "Details (one per line)", Multi: true, Required: true, MaxLen: 1000, MaxLines: 20},
+	},
+	"Contact": {
+		{Label: "Line", Required: true, MaxLen: 80},
+	},
+}
+
+func itemValues(it listItemData) []string {
+	switch d := it.(type) {
+	case educationItem:
+		return []string{d.School, d.Status, d.Dates, strings.Join(d.Details, "\n")}
+	case experienceItem:
+		return []string{d.Company, d.Role, d.Dates, d.Location, d.Reporting, strings.Join(d.Description, "\n")}
+	case projectItem:
+		return []string{d.Name, d.Dates, strings.Join(d.Description, "\n")}
+	case skillsItem:
+		return []string{d.Category, strings.Join(d.Details, "\n")}
+	case contactItem:
+		return []string{d.Line}
+	}
+	return nil
+}
+
+func itemFromValues(section string, v []string) listItemData {
+	switch section {
+	case "Education":
+		return educationItem{School: v[0], Status: v[1], Dates: v[2], Details: splitLines(v[3])}
+	case "Experience":
+		return experienceItem{Company: v[0], Role: v[1], Dates: v[2], Location: v[3], Reporting: v[4], Description: splitLines(v[5])}
+	case "Projects":
+		return projectItem{Name: v[0], Dates: v[1], Description: splitLines(v[2])}
+	case "Skills & Interests":
+		return skillsItem{Category: v[0], Details: splitLines(v[1])}
+	case "Contact":
+		return contactItem{Line: v[0]}
+	}
+	return nil
+}
+
+// editorModel edits a working copy of one section. Nothing is visible to
+// other sessions until it is saved.
+type editorModel struct {
+	section string
+	items   []listItemData
+	cursor  int
+	undo    [][]listItemData
+	form    *form
+	editing int // index being edited by form, -1 when adding
+	dirty   bool
+	confirm bool // esc pressed once with unsaved changes
+	status  string
+}
+
+var (
+	styleEditorCursor = lipgloss.NewStyle().Foreground(activeTabColor).Bold(true)
+	styleEditorStatus = lipgloss.NewStyle().Foreground(helpColor)
+)
+
+func newEditorModel(section string, items []listItemData) *editorModel {
+	return &editorModel{
+		section: section,
+		items:   append([]listItemData(nil), items...),
+		status:  "Editing " + section,
+	}
+}
+
+// mutate records an undo step before the working copy changes.
+func (e *editorModel) mutate() {
+	e.undo = append(e.undo, append([]listItemData(nil), e.items...))
+	e.dirty = true
+	e.confirm = false
+}
+
+// update handles a message; done reports that the editor should close.
+func (e *editorModel) update(msg tea.Msg) (done bool, cmd tea.Cmd) {
+	keyMsg, isKey := msg.(tea.KeyMsg)
+
+	if e.form != nil {
+		if isKey {
+			switch keyMsg.String() {
+			case "esc":
+				e.form = nil
+				e.status = "Edit cancelled"
+				return false, nil
+			case "ctrl+s":
+				if !e.form.validate() {
+					return false, nil
+				}
+				it := itemFromValues(e.section, e.form.values())
+				e.mutate()
+				if e.editing < 0 {
+					// New entries go below the cursor
+					if len(e.items) > 0 {
+						e.cursor++
+					}
+					e.items = append(e.items[:e.cursor], append([]listItemData{it}, e.items[e.cursor:]...)...)
+					e.status = "Entry added (unsaved)"
+				} else {
+					e.items[e.editing] = it
+					e.status = "Entry updated (unsaved)"
+				}
+				e.form = nil
+				return false, nil
+			}
+		}
+		return false, e.form.update(msg)
+	}
+
+	if !isKey {
+		return false, nil
+	}
+	switch keyMsg.String() {
+	case "up", "k":
+		if e.cursor > 0 {
+			e.cursor--
+		}
+	case "down", "j":
+		if e.cursor < len(e.items)-1 {
+			e.cursor++
+		}
+	case "enter":
+		if len(e.items) > 0 {
+			e.editing = e.cursor
+			e.form = newForm("Edit entry", editorFields[e.section], itemValues(e.items[e.cursor]))
+		}
+	case "a":
+		e.editing = -1
+		e.form = newForm("New entry", editorFields[e.section], nil)
+	case "d":
+		if len(e.items) > 0 {
+			e.mutate()
+			e.items = append(e.items[:e.cursor], e.items[e.cursor+1:]...)
+			if e.cursor >= len(e.items) && e.cursor > 0 {
+				e.cursor--
+			}
+			e.status = "Entry deleted (unsaved)"
+		}
+	case "K", "shift+up":
+		if e.cursor > 0 {
+			e.mutate()
+			e.items[e.cursor-1], e.items[e.cursor] = e.items[e.cursor], e.items[e.cursor-1]
+			e.cursor--
+		}
+	case "J", "shift+down":
+		if e.cursor < len(e.items)-1 {
+			e.mutate()
+			e.items[e.cursor+1], e.items[e.cursor] = e.items[e.cursor], e.items[e.cursor+1]
+			e.cursor++
+		}
+	case "u":
+		if len(e.undo) == 0 {
+			e.status = "Nothing to undo"
+			break
+		}
+		e.items = e.undo[len(e.undo)-1]
+		e.undo = e.undo[:len(e.undo)-1]
+		e.cursor = min(e.cursor, max(len(e.items)-1, 0))
+		e.dirty = true
+		e.status = "Undone"
+	case "s":
+		if err := content.saveSection(e.section, e.items); err != nil {
+			e.status = "Save failed: " + err.Error()
+			break
+		}
+		e.dirty = false
+		e.confirm = false
+		e.status = "Saved and published"
+	case "esc":
+		if e.dirty && !e.confirm {
+			e.confirm = true
+			e.status = "Unsaved changes: press esc again to discard, s to save"
+			break
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (e *editorModel) view(w, h int) string {
+	var body string
+	if e.form != nil {
+		body = e.form.view(w - 4)
+	} else {
+		var b strings.Builder
+		b.WriteString(styleItemTitle.Render(fmt.Sprintf("%s (%d entries)", e.section, len(e.items))))
+		b.WriteString("\n\n")
+		if len(e.items) == 0 {
+			b.WriteString(styleItemSubtitle.Render("No entries. Press a to add one."))
+		}
+		for i, it := range e.items {
+			line := "  " + it.FilterValue()
+			if i == e.cursor {
+				line = styleEditorCursor.Render("› " + it.FilterValue())
+			}
+			b.WriteString(line + "\n")
+		}
+		body = b.String()
+	}
+
+	status := e.status
+	if e.dirty {
+		status += " • modified"
+	}
+	body = lipgloss.NewStyle().Width(w).Height(h - 1).MaxHeight(h - 1).PaddingLeft(1).Render(body)
+	return lipgloss.JoinVertical(lipgloss.Left, body, styleEditorStatus.Render(" "+status))
+}
+
+func (e *editorModel) help() string {
+	if e.form != nil {
+		return "tab: next field • ctrl+s: apply • esc: cancel"
+	}
+	return "enter: edit • a: add • d: delete • K/J: move • u: undo • s: save • esc: exit"
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var namedKeys = map[string]tea.KeyType{
+	"up":       tea.KeyUp,
+	"down":     tea.KeyDown,
+	"enter":    tea.KeyEnter,
+	"esc":      tea.KeyEsc,
+	"tab":      tea.KeyTab,
+	"ctrl+s":   tea.KeyCtrlS,
+	"shift+up": tea.KeyShiftUp,
+}
+
+// press sends each key to e, typing anything that isn't a named key.
+func press(e *editorModel, keys ...string) (done bool) {
+	for _, k := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		if typ, ok := namedKeys[k]; ok {
+			msg = tea.KeyMsg{Type: typ}
+		}
+		done, _ = e.update(msg)
+	}
+	return done
+}
+
+func contactLines(items []listItemData) []string {
+	var lines []string
+	for _, it := range items {
+		lines = append(lines, it.(contactItem).Line)
+	}
+	return lines
+}
+
+func testEditor(lines ...string) *editorModel {
+	var items []listItemData
+	for _, l := range lines {
+		items = append(items, contactItem{Line: l})
+	}
+	return newEditorModel("Contact", items)
+}
+
+func TestEditorEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{name: "add below cursor", keys: []string{"a", "new", "ctrl+s"}, want: []string{"one", "new", "two", "three"}},
+		{name: "add cancelled", keys: []string{"a", "new", "esc"}, want: []string{"one", "two", "three"}},
+		{name: "add needs a value", keys: []string{"a", "ctrl+s", "esc"}, want: []string{"one", "two", "three"}},
+		{name: "edit", keys: []string{"down", "enter", " more", "ctrl+s"}, want: []string{"one", "two more", "three"}},
+		{name: "delete", keys: []string{"down", "d"}, want: []string{"one", "three"}},
+		{name: "delete last moves cursor up", keys: []string{"down", "down", "d", "d"}, want: []string{"one"}},
+		{name: "move down", keys: []string{"J"}, want: []string{"two", "one", "three"}},
+		{name: "move up", keys: []string{"down", "down", "shift+up", "K"}, want: []string{"three", "one", "two"}},
+		{name: "move past the top", keys: []string{"K"}, want: []string{"one", "two", "three"}},
+		{name: "undo", keys: []string{"d", "d", "u"}, want: []string{"two", "three"}},
+		{name: "undo all", keys: []string{"d", "J", "u", "u", "u"}, want: []string{"one", "two", "three"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEditor("one", "two", "three")
+			press(e, tt.keys...)
+			if got := contactLines(e.items); !equalStrings(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEditorUndoKeepsOriginal(t *testing.T) {
+	original := []listItemData{contactItem{Line: "one"}, contactItem{Line: "two"}}
+	e := newEditorModel("Contact", original)
+	press(e, "J", "d")
+	if got := contactLines(original); !equalStrings(got, []string{"one", "two"}) {
+		t.Errorf("editing changed the session's copy: %q", got)
+	}
+	if press(e, "u"); e.status != "Undone" {
+		t.Errorf("got status %q", e.status)
+	}
+	press(e, "u", "u")
+	if e.status != "Nothing to undo" {
+		t.Errorf("got status %q with an empty undo stack", e.status)
+	}
+}
+
+func TestEditorDiscardNeedsConfirm(t *testing.T) {
+	e := testEditor("one")
+	if !press(e, "esc") {
+		t.Error("esc without changes should close the editor")
+	}
+	e = testEditor("one")
+	if press(e, "d", "esc") {
+		t.Fatal("closed with unsaved changes after one esc")
+	}
+	if !press(e, "esc") {
+		t.Error("second esc should discard and close")
+	}
+}
+
+func TestEditorSave(t *testing.T) {
+	saved := content
+	t.Cleanup(func() { content = saved })
+	path := filepath.Join(t.TempDir(), "resume.json")
+	content = &contentStore{path: path, data: resumeData}
+
+	e := newEditorModel("Contact", resumeData["Contact"])
+	press(e, "a", "hello@example.com", "ctrl+s", "s")
+	if e.dirty || e.status != "Saved and published" {
+		t.Fatalf("got status %q, dirty %v", e.status, e.dirty)
+	}
+
+	check := &contentStore{path: path}
+	if err := check.load(); err != nil {
+		t.Fatal(err)
+	}
+	got := contactLines(check.snapshot()["Contact"])
+	if len(got) != len(resumeData["Contact"])+1 || got[1] != "hello@example.com" {
+		t.Errorf("saved contact lines %q", got)
+	}
+	if len(check.snapshot()["Experience"]) != len(resumeData["Experience"]) {
+		t.Error("saving one section changed another")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable; sharing the data dir
+// between processes is only supported on Unix.
+func lockFile(*os.File) error { return nil }
+
+func unlockFile(*os.File) error { return nil }
+
+// syncDir is a no-op; directories cannot be fsynced on these platforms.
+func syncDir(string) error { return nil }
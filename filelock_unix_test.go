@@ -0,0 +1,126 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveSectionRereadsUnderLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.json")
+	c := &contentStore{path: path, data: resumeData}
+
+	// Another process writes the file while holding the lock; the save
+	// waits for it and keeps that write
+	holding := make(chan struct{})
+	release := make(chan struct{})
+	locked := make(chan error)
+	go func() {
+		locked <- withFileLock(path, func() error {
+			close(holding)
+			<-release
+			return os.WriteFile(path, []byte(`{"skills": [{"category": "Languages", "details": ["Go"]}]}`), 0o600)
+		})
+	}()
+	<-holding
+
+	saved := make(chan error)
+	go func() {
+		saved <- c.saveSection("Contact", []listItemData{contactItem{Line: "hello@example.com"}})
+	}()
+	select {
+	case err := <-saved:
+		t.Fatalf("saved while the file was locked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-locked; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-saved; err != nil {
+		t.Fatal(err)
+	}
+
+	check := &contentStore{path: path}
+	if err := check.load(); err != nil {
+		t.Fatal(err)
+	}
+	got := check.snapshot()
+	if s, ok := got["Skills & Interests"][0].(skillsItem); !ok || s.Category != "Languages" {
+		t.Errorf("lost the write made under the lock: %#v", got["Skills & Interests"])
+	}
+	if l, ok := got["Contact"][0].(contactItem); !ok || l.Line != "hello@example.com" {
+		t.Errorf("got contact %#v", got["Contact"])
+	}
+}
+
+func TestHostKeysGeneratedOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "ssh_host_ed25519_key")
+	setTestConfig(t, config{HostKeyPath: path, HostKeyTypes: []string{hostKeyEd25519}})
+
+	// Processes starting together each take the lock; only the first
+	// generates, the rest load what it wrote
+	keys := make(chan string, 4)
+	errs := make(chan error, 4)
+	for range 4 {
+		go func() {
+			errs <- withHostKeyLock(func() error {
+				set, err := dataDirHostKeys(true)
+				if err == nil {
+					keys <- string(set.current[0].signer.PublicKey().Marshal())
+				}
+				return err
+			})
+		}()
+	}
+	var first string
+	for i := range 4 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		key := <-keys
+		if i == 0 {
+			first = key
+		} else if key != first {
+			t.Error("processes loaded different host keys")
+		}
+	}
+}
+
+func TestHostKeyGenerationWaitsForLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "ssh_host_ed25519_key")
+	setTestConfig(t, config{HostKeyPath: path, HostKeyTypes: []string{hostKeyEd25519}})
+
+	holding := make(chan struct{})
+	release := make(chan struct{})
+	locked := make(chan error)
+	go func() {
+		locked <- withHostKeyLock(func() error {
+			close(holding)
+			<-release
+			return nil
+		})
+	}()
+	<-holding
+
+	loaded := make(chan error)
+	go func() { loaded <- loadHostKeys() }()
+	select {
+	case err := <-loaded:
+		t.Fatalf("loaded host keys while another process held the lock: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("generated a key without the lock (%v)", err)
+	}
+	close(release)
+	if err := <-locked; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	ssh "github.com/charmbracelet/ssh"
+	wish "github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const serverSection = "About this server"
+
+// SSHFP algorithm numbers (RFC 4255, 6594, 7479); fingerprint type 2 is SHA-256
+var sshfpAlgorithms = map[string]int{
+	hostKeyRSA:     1,
+	hostKeyECDSA:   3,
+	hostKeyEd25519: 4,
+}
+
+// --- Host Key Fingerprints ---
+
+// publicHostPort returns the name and port visitors connect to:
+// public-host when set, otherwise this machine's hostname and the port of
+// the first TCP listen address.
+func publicHostPort() (host, port string) {
+	host, port = cfg.PublicHost, "22"
+	if h, p, err := net.SplitHostPort(cfg.PublicHost); err == nil {
+		return h, p
+	}
+	for _, addr := range cfg.ListenAddrs {
+		if network, address, err := parseListenAddr(addr); err == nil && network != "unix" {
+			_, port, _ = net.SplitHostPort(address)
+			break
+		}
+	}
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return host, port
+}
+
+// hostKeyListing is what visitors need to verify the server: fingerprints,
+// known_hosts lines and SSHFP records for every key presented or announced.
+type hostKeyListing struct {
+	Fingerprints []string
+	KnownHosts   []string
+	SSHFP        []string
+}
+
+func (h hostKeySet) listing() hostKeyListing {
+	host, port := publicHostPort()
+	name := knownhosts.Normalize(net.JoinHostPort(host, port))
+
+	var l hostKeyListing
+	keys := append(append([]hostKey{}, h.current...), h.retired...)
+	for _, k := range keys {
+		pub := k.signer.PublicKey()
+		fp := fmt.Sprintf("%s %s", pub.Type(), gossh.FingerprintSHA256(pub))
+		if k.until.IsZero() {
+			l.Fingerprints = append(l.Fingerprints, fp)
+		} else {
+			l.Fingerprints = append(l.Fingerprints, fp+" (retiring)")
+		}
+		l.KnownHosts = append(l.KnownHosts, knownhosts.Line([]string{name}, pub))
+		sum := sha256.Sum256(pub.Marshal())
+		l.SSHFP = append(l.SSHFP, fmt.Sprintf("%s. IN SSHFP %d 2 %x", strings.TrimSuffix(host, "."), sshfpAlgorithms[k.typ], sum))
+	}
+	seenCA := make(map[string]bool)
+	for _, c := range h.certs {
+		ca := c.cert.SignatureKey
+		if seenCA[string(ca.Marshal())] {
+			continue
+		}
+		seenCA[string(ca.Marshal())] = true
+		l.KnownHosts = append(l.KnownHosts, "@cert-authority "+knownhosts.Line([]string{name}, ca))
+	}
+	return l
+}
+
+// writeTo prints the listing in a form that pastes into known_hosts files
+// and DNS zones.
+func (l hostKeyListing) writeTo(w io.Writer) {
+	section := func(title string, lines []string) {
+		fmt.Fprintf(w, "# %s\n", title)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+		fmt.Fprintln(w)
+	}
+	section("SHA256 fingerprints", l.Fingerprints)
+	section("known_hosts", l.KnownHosts)
+	section("SSHFP records", l.SSHFP)
+}
+
+// aboutServerView renders the "About this server" tab.
+func aboutServerView(width int) string {
+	l := hostKeys.listing()
+	host, port := publicHostPort()
+	wrap := styleItemDesc.Width(max(width-4, 20))
+
+	var b strings.Builder
+	b.WriteString(styleAdminHeading.Render("About this server"))
+	b.WriteString("\n\n")
+	b.WriteString(wrap.Render(fmt.Sprintf("You are connected to %s over SSH. Compare the fingerprint your client showed on first connect with the ones below, or run `ssh %s fingerprints`.", host, sshTarget(host, port))))
+	b.WriteString("\n\n")
+	for _, part := range []struct {
+		title string
+		lines []string
+	}{
+		{"SHA256 fingerprints", l.Fingerprints},
+		{"known_hosts", l.KnownHosts},
+		{"SSHFP records", l.SSHFP},
+	} {
+		b.WriteString(styleItemTitle.Render(part.title))
+		b.WriteString("\n")
+		for _, line := range part.lines {
+			b.WriteString(wrap.Render(line))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// sshTarget is how a visitor would address the server on the ssh command
+// line.
+func sshTarget(host, port string) string {
+	if port == "22" {
+		return host
+	}
+	return "-p " + port + " " + host
+}
+
+// --- Exec Commands ---
+
+// execCommands can be run as `ssh host <command>` without the TUI.
+var execCommands = map[string]func(s ssh.Session) int{
+	"fingerprints": func(s ssh.Session) int {
+		hostKeys.listing().writeTo(s)
+		return 0
+	},
+}
+
+// execMiddleware runs a known exec command instead of the TUI. Anything
+// else falls through, so PTY-less sessions are still turned away.
+func execMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			args := s.Command()
+			if len(args) == 0 {
+				next(s)
+				return
+			}
+			run, ok := execCommands[args[0]]
+			if !ok {
+				next(s)
+				return
+			}
+			_ = s.Exit(run(s))
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --- Forms ---
+
+// fieldSpec describes one input of a form.
+type fieldSpec struct {
+	Label    string
+	Multi    bool // textarea instead of a single-line input
+	Required bool
+	MaxLen   int                // in characters, 0 means unlimited
+	MaxLines int                // multi-line fields only, 0 means unlimited
+	Check    func(string) error // optional extra validation
+}
+
+type formField struct {
+	spec  fieldSpec
+	input textinput.Model
+	area  textarea.Model
+}
+
+// form is a stack of text inputs with validation. The owner decides which
+// keys submit or cancel it.
+type form struct {
+	title  string
+	fields []formField
+	focus  int
+	err    string
+}
+
+var (
+	styleFormLabel   = lipgloss.NewStyle().Bold(true)
+	styleFormFocused = lipgloss.NewStyle().Foreground(activeTabColor).Bold(true)
+	styleFormError   = lipgloss.NewStyle().Foreground(lipgloss.Color("202"))
+)
+
+func newForm(title string, specs []fieldSpec, values []string) *form {
+	f := &form{title: title}
+	for i, spec := range specs {
+		field := formField{spec: spec}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		if spec.Multi {
+			field.area = textarea.New()
+			field.area.ShowLineNumbers = false
+			field.area.CharLimit = spec.MaxLen
+			field.area.SetHeight(4)
+			field.area.SetValue(value)
+		} else {
+			field.input = textinput.New()
+			field.input.Prompt = "> "
+			field.input.CharLimit = spec.MaxLen
+			field.input.SetValue(value)
+		}
+		f.fields = append(f.fields, field)
+	}
+	f.fields[0].focusField()
+	return f
+}
+
+func (ff *formField) focusField() tea.Cmd {
+	if ff.spec.Multi {
+		return ff.area.Focus()
+	}
+	return ff.input.Focus()
+}
+
+func (ff *formField) blurField() {
+	if ff.spec.Multi {
+		ff.area.Blur()
+	} else {
+		ff.input.Blur()
+	}
+}
+
+func (ff *formField) value() string {
+	if ff.spec.Multi {
+		return ff.area.Value()
+	}
+	return ff.input.Value()
+}
+
+func (f *form) values() []string {
+	out := make([]string, len(f.fields))
+	for i := range f.fields {
+		out[i] = strings.TrimSpace(f.fields[i].value())
+	}
+	return out
+}
+
+// validate checks every field, records the first problem for display and
+// moves focus to the offending field.
+func (f *form) validate() bool {
+	for i, v := range f.values() {
+		if err := f.fields[i].spec.validate(v); err != nil {
+			f.err = err.Error()
+			f.setFocus(i)
+			return false
+		}
+	}
+	f.err = ""
+	return true
+}
+
+func (spec fieldSpec) validate(v string) error {
+	if spec.Required && v == "" {
+		return fmt.Errorf("%s is required", spec.Label)
+	}
+	if spec.MaxLen > 0 && utf8.RuneCountInString(v) > spec.MaxLen {
+		return fmt.Errorf("%s must be at most %d characters", spec.Label, spec.MaxLen)
+	}
+	if spec.MaxLines > 0 && len(splitLines(v)) > spec.MaxLines {
+		return fmt.Errorf("%s must be at most %d lines", spec.Label, spec.MaxLines)
+	}
+	if spec.Check != nil && v != "" {
+		if err := spec.Check(v); err != nil {
+			return fmt.Errorf("%s: %w", spec.Label, err)
+		}
+	}
+	return nil
+}
+
+func (f *form) setFocus(i int) tea.Cmd {
+	f.fields[f.focus].blurField()
+	f.focus = i
+	return f.fields[f.focus].focusField()
+}
+
+// update handles field navigation and forwards everything else to the
+// focused input.
+func (f *form) update(msg tea.Msg) tea.Cmd {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "tab", "down":
+			if keyMsg.String() == "tab" || !f.fields[f.focus].spec.Multi {
+				return f.setFocus((f.focus + 1) % len(f.fields))
+			}
+		case "shift+tab", "up":
+			if keyMsg.String() == "shift+tab" || !f.fields[f.focus].spec.Multi {
+				return f.setFocus((f.focus - 1 + len(f.fields)) % len(f.fields))
+			}
+		case "enter":
+			if !f.fields[f.focus].spec.Multi {
+				return f.setFocus((f.focus + 1) % len(f.fields))
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	ff := &f.fields[f.focus]
+	if ff.spec.Multi {
+		ff.area, cmd = ff.area.Update(msg)
+	} else {
+		ff.input, cmd = ff.input.Update(msg)
+	}
+	return cmd
+}
+
+func (f *form) view(width int) string {
+	var b strings.Builder
+	b.WriteString(styleItemTitle.Render(f.title))
+	b.WriteString("\n\n")
+	for i := range f.fields {
+		ff := &f.fields[i]
+		label := styleFormLabel
+		if i == f.focus {
+			label = styleFormFocused
+		}
+		name := ff.spec.Label
+		if ff.spec.Required {
+			name += " *"
+		}
+		b.WriteString(label.Render(name))
+		b.WriteString("\n")
+		if ff.spec.Multi {
+			ff.area.SetWidth(width)
+			b.WriteString(ff.area.View())
+		} else {
+			ff.input.Width = width - lipgloss.Width(ff.input.Prompt) - 1
+			b.WriteString(ff.input.View())
+		}
+		b.WriteString("\n")
+	}
+	if f.err != "" {
+		b.WriteString("\n")
+		b.WriteString(styleFormError.Render(f.err))
+	}
+	return b.String()
+}
+
+// splitLines splits multi-line input into trimmed, non-empty lines.
+func splitLines(v string) []string {
+	var out []string
+	for _, line := range strings.Split(v, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	guestbookSection = "Guestbook"
+	guestbookPerPage = 5
+	maxGuestNameLen  = 40
+	maxGuestMsgLen   = 280
+	maxGuestMsgLines = 5
+	// Entries waiting for moderation before new ones are turned away
+	maxPendingEntries = 100
+)
+
+// Moderation states of a guestbook entry
+const (
+	entryPending  = "pending"
+	entryApproved = "approved"
+	entryRejected = "rejected"
+)
+
+// guestbookChangedMsg is pushed to sessions when entries are added or moderated.
+type guestbookChangedMsg struct{}
+
+type guestbookEntry struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Message     string    `json:"message"`
+	Fingerprint string    `json:"fingerprint,omitempty"` // Empty for keyless visitors
+	Author      string    `json:"author"`                // Rate-limit key: fingerprint or IP
+	Created     time.Time `json:"created"`
+	Status      string    `json:"status"`
+}
+
+var (
+	errGuestbookRateLimited = errors.New("you've signed recently, please come back later")
+	errGuestbookBusy        = errors.New("the guestbook has a backlog of messages to review, please come back later")
+	errGuestbookNotFound    = errors.New("guestbook entry not found")
+)
+
+// --- Guestbook Store ---
+
+type guestbookStore struct {
+	path    string
+	mu      sync.Mutex
+	entries []guestbookEntry // Oldest first, as written
+	// Last entry per IP, so the cooldown holds for visitors who switch keys.
+	// Kept in memory only, to keep addresses out of the guestbook file.
+	lastByIP map[string]time.Time
+}
+
+var guestbook = &guestbookStore{lastByIP: make(map[string]time.Time)} // path is set from cfg.GuestbookPath
+
+func (g *guestbookStore) load() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reload()
+}
+
+// reload replaces the entries with the file's; callers hold g.mu. A
+// missing file leaves them as they are.
+func (g *guestbookStore) reload() error {
+	raw, err := os.ReadFile(g.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read guestbook: %w", err)
+	}
+	var entries []guestbookEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return fmt.Errorf("failed to parse guestbook %s: %w", g.path, err)
+	}
+	for i := range entries {
+		// Entries from older versions were stored unfiltered
+		entries[i].Name = sanitizeGuestText(entries[i].Name, maxGuestNameLen)
+		entries[i].Message = sanitizeGuestText(entries[i].Message, maxGuestMsgLen)
+	}
+	g.entries = entries
+	return nil
+}
+
+// update runs fn on the latest entries and saves them, holding g.mu and
+// the file lock, so writes from another process sharing the file are
+// never lost. The entries are left as they were if fn or the save fails.
+func (g *guestbookStore) update(fn func() error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return withFileLock(g.path, func() error {
+		if err := g.reload(); err != nil {
+			return err
+		}
+		prev := slices.Clone(g.entries)
+		if err := fn(); err != nil {
+			g.entries = prev
+			return err
+		}
+		if err := g.persist(); err != nil {
+			g.entries = prev
+			return err
+		}
+		return nil
+	})
+}
+
+// persist writes all entries; callers hold g.mu and the file lock.
+func (g *guestbookStore) persist() error {
+	raw, err := json.MarshalIndent(g.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(g.path, append(raw, '\n'), 0644)
+}
+
+// sanitizeGuestText strips control characters other than line breaks, so
+// entries can't send escape sequences to other visitors' terminals, and
+// trims the text to limit runes.
+func sanitizeGuestText(text string, limit int) string {
+	text = strings.Map(func(r rune) rune {
+		if r != '\n' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = strings.TrimSpace(strings.Join(lines, "\n"))
+	if runes := []rune(text); len(runes) > limit {
+		text = strings.TrimSpace(string(runes[:limit]))
+	}
+	return text
+}
+
+// submit queues a message for moderation.
+func (g *guestbookStore) submit(name, message string, info sessionInfo) error {
+	name = sanitizeGuestText(name, maxGuestNameLen)
+	message = sanitizeGuestText(message, maxGuestMsgLen)
+	if name == "" || message == "" {
+		return errors.New("name and message can't be empty")
+	}
+	author := info.Fingerprint
+	if author == "" {
+		author = "ip:" + hostOnly(info.RemoteAddr)
+	}
+	ip := hostOnly(info.RemoteAddr)
+
+	err := g.update(func() error {
+		for key, last := range g.lastByIP {
+			if time.Since(last) >= cfg.GuestbookCooldown {
+				delete(g.lastByIP, key)
+			}
+		}
+		if _, ok := g.lastByIP[ip]; ok {
+			return errGuestbookRateLimited
+		}
+		pending := 0
+		for i := len(g.entries) - 1; i >= 0; i-- {
+			if g.entries[i].Author == author && time.Since(g.entries[i].Created) < cfg.GuestbookCooldown {
+				return errGuestbookRateLimited
+			}
+			if g.entries[i].Status == entryPending {
+				pending++
+			}
+		}
+		if pending >= maxPendingEntries {
+			return errGuestbookBusy
+		}
+		g.entries = append(g.entries, guestbookEntry{
+			ID:          newEntryID(),
+			Name:        name,
+			Message:     message,
+			Fingerprint: info.Fingerprint,
+			Author:      author,
+			Created:     time.Now(),
+			Status:      entryPending,
+		})
+		return nil
+	})
+	if errors.Is(err, errGuestbookRateLimited) || errors.Is(err, errGuestbookBusy) {
+		return err
+	}
+	if err != nil {
+		slog.Error("Failed to save guestbook entry", "err", err)
+		return errors.New("could not save your message, please try again later")
+	}
+	if cfg.GuestbookCooldown > 0 {
+		g.mu.Lock()
+		g.lastByIP[ip] = time.Now()
+		g.mu.Unlock()
+	}
+	hub.sendToAdmins(guestbookChangedMsg{})
+	return nil
+}
+
+// moderate sets the status of a pending entry.
+func (g *guestbookStore) moderate(id, status string) error {
+	err := g.update(func() error {
+		for i := range g.entries {
+			if g.entries[i].ID == id {
+				g.entries[i].Status = status
+				return nil
+			}
+		}
+		return errGuestbookNotFound
+	})
+	if errors.Is(err, errGuestbookNotFound) {
+		return fmt.Errorf("entry %s: %w", id, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save guestbook: %w", err)
+	}
+	hub.broadcast(guestbookChangedMsg{})
+	return nil
+}
+
+// byStatus returns entries with the given status, newest first.
+func (g *guestbookStore) byStatus(status string) []guestbookEntry {
+	g.mu.Lock()
+	var out []guestbookEntry
+	for _, e := range g.entries {
+		if e.Status == status {
+			out = append(out, e)
+		}
+	}
+	g.mu.Unlock()
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out
+}
+
+func newEntryID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// --- Guestbook Tab ---
+
+var guestbookFields = []fieldSpec{
+	{Label: "Name", Required: true, MaxLen: maxGuestNameLen},
+	{Label: "Message", Multi: true, Required: true, MaxLen: maxGuestMsgLen, MaxLines: maxGuestMsgLines},
+}
+
+type guestbookModel struct {
+	page   int
+	form   *form
+	status string
+}
+
+func (g *guestbookModel) update(msg tea.Msg, sessionID string) tea.Cmd {
+	keyMsg, isKey := msg.(tea.KeyMsg)
+
+	if g.form != nil {
+		if isKey {
+			switch keyMsg.String() {
+			case "esc":
+				g.form = nil
+				return nil
+			case "ctrl+s":
+				if !g.form.validate() {
+					return nil
+				}
+				info, _ := hub.session(sessionID)
+				v := g.form.values()
+				if err := guestbook.submit(v[0], v[1], info); err != nil {
+					g.form.err = err.Error()
+					return nil
+				}
+				g.form = nil
+				g.status = "Thanks! Your message will appear once it's approved."
+				return nil
+			}
+		}
+		return g.form.update(msg)
+	}
+
+	if !isKey {
+		return nil
+	}
+	pages := guestbookPages(len(guestbook.byStatus(entryApproved)))
+	switch keyMsg.String() {
+	case "w":
+		info, _ := hub.session(sessionID)
+		g.form = newForm("Sign the guestbook", guestbookFields, []string{info.User})
+		g.status = ""
+		return g.form.setFocus(1)
+	case "n", "pgdown", "down", "j":
+		if g.page < pages-1 {
+			g.page++
+		}
+	case "p", "pgup", "up", "k":
+		if g.page > 0 {
+			g.page--
+		}
+	}
+	return nil
+}
+
+func guestbookPages(n int) int {
+	return max(1, (n+guestbookPerPage-1)/guestbookPerPage)
+}
+
+func (g *guestbookModel) view(w, h int) string {
+	var body string
+	if g.form != nil {
+		body = g.form.view(w - 4)
+	} else {
+		entries := guestbook.byStatus(entryApproved)
+		pages := guestbookPages(len(entries))
+		g.page = min(g.page, pages-1)
+
+		var b strings.Builder
+		noun := "messages"
+		if len(entries) == 1 {
+			noun = "message"
+		}
+		b.WriteString(styleItemTitle.Render(fmt.Sprintf("Guestbook • %d %s", len(entries), noun)))
+		b.WriteString(styleItemSubtitle.Render(fmt.Sprintf("  page %d/%d", g.page+1, pages)))
+		b.WriteString("\n")
+		if g.status != "" {
+			b.WriteString(styleFormFocused.Render(g.status))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+		if len(entries) == 0 {
+			b.WriteString(styleItemSubtitle.Render("No messages yet. Press w to be the first!"))
+		}
+		start := g.page * guestbookPerPage
+		end := min(start+guestbookPerPage, len(entries))
+		for _, e := range entries[start:end] {
+			b.WriteString(renderGuestbookEntry(e, w-4))
+			b.WriteString("\n\n")
+		}
+		body = b.String()
+	}
+	return lipgloss.NewStyle().PaddingLeft(1).MaxHeight(h).Render(body)
+}
+
+func renderGuestbookEntry(e guestbookEntry, width int) string {
+	signed := "unverified"
+	if e.Fingerprint != "" {
+		signed = shortFingerprint(e.Fingerprint)
+	}
+	title := styleItemTitle.Render(e.Name)
+	subtitle := styleItemSubtitle.Render(fmt.Sprintf(" • %s • %s", e.Created.Format("Jan 2, 2006"), signed))
+	message := styleItemDesc.Copy().Width(width).Render(e.Message)
+	return lipgloss.JoinVertical(lipgloss.Left, title+subtitle, message)
+}
+
+// shortFingerprint trims a SHA256 fingerprint for display.
+func shortFingerprint(fp string) string {
+	if len(fp) > 19 {
+		return fp[:19] + "…"
+	}
+	return fp
+}
+
+func (g *guestbookModel) help() string {
+	if g.form != nil {
+		return "tab: next field • ctrl+s: submit • esc: cancel"
+	}
+	return "←/→: switch • w: write • n/p: page • q: quit"
+}
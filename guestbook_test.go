@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanitizeGuestText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"hello", "hello"},
+		{"two\nlines", "two\nlines"},
+		{"\x1b[2Jcleared\x1b]0;title\x07", "[2Jcleared]0;title"},
+		{"bell\a and\r return", "bell and return"},
+		{"  padded  \n", "padded"},
+		{"\x1b\x1b", ""},
+	}
+	for _, tt := range tests {
+		if got := sanitizeGuestText(tt.in, 100); got != tt.want {
+			t.Errorf("sanitizeGuestText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got := sanitizeGuestText("abcdef", 3); got != "abc" {
+		t.Errorf("got %q, want the text cut to 3 runes", got)
+	}
+}
+
+// testGuestbook returns an empty guestbook in a temporary directory.
+func testGuestbook(t *testing.T, cooldown time.Duration) *guestbookStore {
+	t.Helper()
+	setTestConfig(t, config{GuestbookCooldown: cooldown})
+	return &guestbookStore{
+		path:     filepath.Join(t.TempDir(), "guestbook.json"),
+		lastByIP: make(map[string]time.Time),
+	}
+}
+
+func TestGuestbookSubmitSanitizes(t *testing.T) {
+	g := testGuestbook(t, 0)
+	info := sessionInfo{Fingerprint: "SHA256:a", RemoteAddr: "192.0.2.1:1"}
+	if err := g.submit("\x1b[31mEve", "hi\x1b[2J\nthere", info); err != nil {
+		t.Fatal(err)
+	}
+	e := g.entries[0]
+	if e.Name != "[31mEve" || e.Message != "hi[2J\nthere" {
+		t.Errorf("stored %q / %q", e.Name, e.Message)
+	}
+	if err := g.submit("\x1b", "hi", info); err == nil {
+		t.Error("want an error for a name that is only control characters")
+	}
+
+	// Entries already on disk are cleaned on load
+	g.entries[0].Name = "\x1b[5mOld"
+	if err := g.persist(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.load(); err != nil {
+		t.Fatal(err)
+	}
+	if g.entries[0].Name != "[5mOld" {
+		t.Errorf("loaded name %q", g.entries[0].Name)
+	}
+}
+
+func TestGuestbookCooldownPerIP(t *testing.T) {
+	g := testGuestbook(t, time.Minute)
+	first := sessionInfo{Fingerprint: "SHA256:a", RemoteAddr: "192.0.2.1:1"}
+	if err := g.submit("A", "hi", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.submit("A", "again", first); err != errGuestbookRateLimited {
+		t.Errorf("same key: got %v, want errGuestbookRateLimited", err)
+	}
+	freshKey := sessionInfo{Fingerprint: "SHA256:b", RemoteAddr: "192.0.2.1:2"}
+	if err := g.submit("A", "new key", freshKey); err != errGuestbookRateLimited {
+		t.Errorf("fresh key, same IP: got %v, want errGuestbookRateLimited", err)
+	}
+	other := sessionInfo{Fingerprint: "SHA256:c", RemoteAddr: "192.0.2.2:1"}
+	if err := g.submit("C", "hello", other); err != nil {
+		t.Errorf("other IP: %v", err)
+	}
+
+	g.lastByIP["192.0.2.1"] = time.Now().Add(-2 * time.Minute)
+	g.entries[0].Created = time.Now().Add(-2 * time.Minute)
+	if err := g.submit("A", "later", freshKey); err != nil {
+		t.Errorf("after the cooldown: %v", err)
+	}
+}
+
+func TestGuestbookPendingCap(t *testing.T) {
+	g := testGuestbook(t, 0)
+	for i := range maxPendingEntries {
+		info := sessionInfo{Fingerprint: fmt.Sprintf("SHA256:%d", i), RemoteAddr: fmt.Sprintf("192.0.2.%d:1", i%250)}
+		if err := g.submit("N", "hi", info); err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+	}
+	extra := sessionInfo{Fingerprint: "SHA256:extra", RemoteAddr: "198.51.100.1:1"}
+	if err := g.submit("N", "hi", extra); err != errGuestbookBusy {
+		t.Fatalf("got %v, want errGuestbookBusy", err)
+	}
+	if err := g.moderate(g.entries[0].ID, entryApproved); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.submit("N", "hi", extra); err != nil {
+		t.Errorf("after moderating one: %v", err)
+	}
+}
+
+func TestGuestbookModerateUnknownEntry(t *testing.T) {
+	g := testGuestbook(t, 0)
+	err := g.moderate("no-such-id", entryApproved)
+	if !errors.Is(err, errGuestbookNotFound) {
+		t.Fatalf("got %v, want errGuestbookNotFound", err)
+	}
+	if strings.Contains(err.Error(), "failed to save") {
+		t.Errorf("got %q, a missing entry is not a save failure", err)
+	}
+}
+
+func TestGuestbookMergesConcurrentWriters(t *testing.T) {
+	// Two stores on one file, like the old and new process during an upgrade
+	oldProc := testGuestbook(t, 0)
+	newProc := &guestbookStore{path: oldProc.path, lastByIP: make(map[string]time.Time)}
+
+	if err := oldProc.submit("Old", "from the draining process", sessionInfo{Fingerprint: "SHA256:a", RemoteAddr: "192.0.2.1:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := newProc.submit("New", "from the new process", sessionInfo{Fingerprint: "SHA256:b", RemoteAddr: "192.0.2.2:1"}); err != nil {
+		t.Fatal(err)
+	}
+	// The old process moderates with its stale copy in memory
+	if err := oldProc.moderate(oldProc.entries[0].ID, entryApproved); err != nil {
+		t.Fatal(err)
+	}
+
+	check := &guestbookStore{path: oldProc.path}
+	if err := check.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(check.entries) != 2 {
+		t.Fatalf("got %d entries on disk, want both", len(check.entries))
+	}
+	if check.entries[0].Status != entryApproved || check.entries[1].Status != entryPending {
+		t.Errorf("got statuses %s, %s", check.entries[0].Status, check.entries[1].Status)
+	}
+}
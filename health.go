@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Readiness checks that must all pass before /readyz reports ready
+const (
+	checkHostKey  = "host_key"
+	checkContent  = "content"
+	checkListener = "listener"
+)
+
+// readiness tracks which startup checks have completed.
+type readiness struct {
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+var ready = newReadiness(checkHostKey, checkContent, checkListener)
+
+func newReadiness(checks ...string) *readiness {
+	r := &readiness{pending: make(map[string]bool)}
+	for _, c := range checks {
+		r.pending[c] = true
+	}
+	return r
+}
+
+// set marks a check as passed.
+func (r *readiness) set(check string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, check)
+}
+
+// unset marks a check as failing again, e.g. once the listener is closed.
+func (r *readiness) unset(check string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[check] = true
+}
+
+// missing lists the checks that have not passed yet.
+func (r *readiness) missing() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, 0, len(r.pending))
+	for c := range r.pending {
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// serveHealth exposes /healthz (the process is up) and /readyz (the server
+// can take connections) on ln until it is closed.
+func serveHealth(ln net.Listener) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if missing := ready.missing(); len(missing) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "not ready:", strings.Join(missing, ", "))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	slog.Info("Serving health checks", "url", "http://"+ln.Addr().String()+"/healthz")
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Error("Health server failed", "err", err)
+	}
+}
+
+// runHealthcheck implements the `healthcheck` subcommand: it queries
+// /readyz on the local health port and returns the process exit code, so
+// container probes need no curl.
+func runHealthcheck(args []string) int {
+	if _, err := loadConfig(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if cfg.HealthAddr == "" {
+		fmt.Fprintln(os.Stderr, "health endpoints are disabled (health-addr is empty)")
+		return 1
+	}
+	host, port, err := net.SplitHostPort(cfg.HealthAddr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid health-addr:", err)
+		return 1
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + "/readyz")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "unhealthy:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	fmt.Print(string(body))
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
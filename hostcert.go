@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Warn at startup when a host certificate expires sooner than this
+const hostCertExpiryWarning = 30 * 24 * time.Hour
+
+// --- Host Certificates ---
+
+// hostCert is an OpenSSH host certificate and the signer that presents it.
+type hostCert struct {
+	path   string
+	cert   *gossh.Certificate
+	signer gossh.Signer
+}
+
+// hostCertPaths returns the configured certificates or, when none are
+// configured, the <key>-cert.pub files that exist next to the host keys.
+func hostCertPaths() []string {
+	if len(cfg.HostCerts) > 0 {
+		return cfg.HostCerts
+	}
+	var paths []string
+	for _, typ := range cfg.HostKeyTypes {
+		path := hostKeyPath(typ) + "-cert.pub"
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// loadHostCerts pairs each certificate with its host key. A certificate
+// that is not a host certificate, is not signed correctly, is outside its
+// validity period or matches none of our keys is an error.
+func loadHostCerts(keys []hostKey) ([]hostCert, error) {
+	var certs []hostCert
+	for _, path := range hostCertPaths() {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read host certificate: %w", err)
+		}
+		pub, _, _, _, err := gossh.ParseAuthorizedKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse host certificate %s: %w", path, err)
+		}
+		cert, ok := pub.(*gossh.Certificate)
+		if !ok || cert.CertType != gossh.HostCert {
+			return nil, fmt.Errorf("%s is not an OpenSSH host certificate", path)
+		}
+		if err := checkHostCert(cert); err != nil {
+			return nil, fmt.Errorf("host certificate %s: %w", path, err)
+		}
+
+		var key gossh.Signer
+		for _, k := range keys {
+			if bytes.Equal(k.signer.PublicKey().Marshal(), cert.Key.Marshal()) {
+				key = k.signer
+			}
+		}
+		if key == nil {
+			return nil, fmt.Errorf("host certificate %s does not match any host key (certifies %s)", path, gossh.FingerprintSHA256(cert.Key))
+		}
+		signer, err := gossh.NewCertSigner(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("host certificate %s: %w", path, err)
+		}
+		certs = append(certs, hostCert{path: path, cert: cert, signer: signer})
+	}
+	return certs, nil
+}
+
+// checkHostCert verifies the CA signature and the validity period.
+func checkHostCert(cert *gossh.Certificate) error {
+	principal := ""
+	if len(cert.ValidPrincipals) > 0 {
+		principal = cert.ValidPrincipals[0]
+	}
+	checker := gossh.CertChecker{}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return err
+	}
+	if len(cert.ValidPrincipals) == 0 {
+		return errors.New("certificate names no host principals")
+	}
+	return nil
+}
+
+// expires returns when the certificate stops being valid; the zero time
+// means never.
+func (c hostCert) expires() time.Time {
+	if c.cert.ValidBefore == gossh.CertTimeInfinity {
+		return time.Time{}
+	}
+	return time.Unix(int64(c.cert.ValidBefore), 0)
+}
+
+func (c hostCert) logInfo() {
+	until := "forever"
+	if exp := c.expires(); !exp.IsZero() {
+		until = "until " + exp.Format(time.RFC3339)
+		if time.Until(exp) < hostCertExpiryWarning {
+			slog.Warn("Host certificate expires soon; renew it", "path", c.path, "expires_in", time.Until(exp).Round(time.Hour))
+		}
+	}
+	slog.Info("Host certificate", "type", c.cert.Key.Type(), "principals", strings.Join(c.cert.ValidPrincipals, ","),
+		"ca", gossh.FingerprintSHA256(c.cert.SignatureKey), "valid", until, "path", c.path)
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	ssh "github.com/charmbracelet/ssh"
+	wish "github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Supported host key types, in the order they are offered
+const (
+	hostKeyEd25519 = "ed25519"
+	hostKeyECDSA   = "ecdsa"
+	hostKeyRSA     = "rsa"
+)
+
+const (
+	rsaHostKeyBits   = 3072
+	retiredKeySuffix = ".old" // Previous key kept for the rotation grace period
+	hostKeyLockName  = ".hostkey.lock"
+
+	// OpenSSH extensions for announcing host keys after authentication
+	// (UpdateHostKeys in ssh_config), see PROTOCOL in the OpenSSH source.
+	reqHostKeys      = "hostkeys-00@openssh.com"
+	reqHostKeysProve = "hostkeys-prove-00@openssh.com"
+)
+
+var hostKeyTypes = []string{hostKeyEd25519, hostKeyECDSA, hostKeyRSA}
+
+// hostKeysSentKey marks connections that have been sent hostkeys-00.
+var hostKeysSentKey = &struct{ name string }{"hostkeys-sent"}
+
+// --- Host Keys ---
+
+// hostKeyPath returns where the key of the given type lives. The ed25519
+// key is host-key itself; the others sit next to it, named like OpenSSH's.
+func hostKeyPath(typ string) string {
+	if typ == hostKeyEd25519 {
+		return cfg.HostKeyPath
+	}
+	return filepath.Join(filepath.Dir(cfg.HostKeyPath), "ssh_host_"+typ+"_key")
+}
+
+func generateHostKey(typ string) (crypto.Signer, error) {
+	switch typ {
+	case hostKeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case hostKeyECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case hostKeyRSA:
+		return rsa.GenerateKey(rand.Reader, rsaHostKeyBits)
+	}
+	return nil, fmt.Errorf("unknown host key type %q", typ)
+}
+
+// withHostKeyLock runs fn holding an exclusive lock in the key directory,
+// so processes sharing it never generate, rotate and load keys at once.
+func withHostKeyLock(fn func() error) error {
+	keyDir := filepath.Dir(cfg.HostKeyPath)
+	if err := os.MkdirAll(keyDir, 0700); err != nil {
+		return fmt.Errorf("failed to create key directory %s: %w", keyDir, err)
+	}
+	f, err := os.OpenFile(filepath.Join(keyDir, hostKeyLockName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open host key lock: %w", err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("failed to lock host key directory: %w", err)
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+// ensureHostKey checks if the host key pair of the given type exists,
+// generating it if necessary. Callers hold the host key lock.
+func ensureHostKey(typ string) error {
+	privateKeyPath := hostKeyPath(typ)
+	_, err := os.Stat(privateKeyPath)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to check for host key: %w", err)
+	}
+
+	slog.Info("Host key not found, generating a new key pair", "type", typ, "path", privateKeyPath)
+	return writeHostKey(typ, privateKeyPath)
+}
+
+// writeHostKey generates a key of the given type and writes it to path and
+// path.pub in OpenSSH format. Each file is synced and renamed into place,
+// the public key first: a crash in between leaves no private key, so the
+// pair is simply generated again.
+func writeHostKey(typ, path string) error {
+	privKey, err := generateHostKey(typ)
+	if err != nil {
+		return fmt.Errorf("failed to generate %s key pair: %w", typ, err)
+	}
+	opensshPrivKey, err := gossh.MarshalPrivateKey(privKey, "")
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	sshPubKey, err := gossh.NewPublicKey(privKey.Public())
+	if err != nil {
+		return fmt.Errorf("failed to create ssh public key: %w", err)
+	}
+
+	if err := writeFileAtomic(path+".pub", gossh.MarshalAuthorizedKey(sshPubKey), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+	if err := writeFileAtomic(path, pem.EncodeToMemory(opensshPrivKey), 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("failed to sync key directory: %w", err)
+	}
+	slog.Info("Wrote host key pair", "path", path)
+	return nil
+}
+
+// loadHostSigner loads the private key at path and checks it against
+// path.pub, so a corrupted or mismatched pair is never served.
+func loadHostSigner(path string) (gossh.Signer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host key: %w", err)
+	}
+	signer, err := gossh.ParsePrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("host key %s is corrupt: %w", path, err)
+	}
+
+	rawPub, err := os.ReadFile(path + ".pub")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("host key %s has no public key %s.pub; restore it, or delete the private key to generate a new pair", path, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public host key: %w", err)
+	}
+	pub, _, _, _, err := gossh.ParseAuthorizedKey(rawPub)
+	if err != nil {
+		return nil, fmt.Errorf("public host key %s.pub is corrupt: %w", path, err)
+	}
+	if !bytes.Equal(pub.Marshal(), signer.PublicKey().Marshal()) {
+		return nil, fmt.Errorf("host key %s does not match %s.pub (%s vs %s); restore the right pair, or delete both to generate a new one",
+			path, path, gossh.FingerprintSHA256(signer.PublicKey()), gossh.FingerprintSHA256(pub))
+	}
+	return signer, nil
+}
+
+// hostKey is one loaded key. Retired keys are the ones replaced by the last
+// rotation; they stay in use until their grace period ends.
+type hostKey struct {
+	typ    string
+	path   string
+	signer gossh.Signer
+	until  time.Time // Retired keys only: end of the grace period
+}
+
+// hostKeySet holds every key and certificate the server presents or
+// announces.
+type hostKeySet struct {
+	current []hostKey
+	retired []hostKey
+	certs   []hostCert
+}
+
+// hostKeys is loaded once at startup by loadHostKeys.
+var hostKeys hostKeySet
+
+// loadHostKeys uses the keys supplied from outside when there are any.
+// Otherwise it generates missing keys of the configured types in the data
+// dir and loads them with any retired keys still within the rotation grace
+// period.
+func loadHostKeys() error {
+	external, err := externalHostKeys()
+	if err != nil {
+		return err
+	}
+	if len(external) == 0 {
+		return withHostKeyLock(loadHostKeysLocked)
+	}
+	certs, err := loadHostCerts(external)
+	if err != nil {
+		return err
+	}
+	hostKeys = hostKeySet{current: external, certs: certs}
+	return nil
+}
+
+// readHostKeys loads the same keys as loadHostKeys without writing
+// anything: a missing key is an error rather than generated, and expired
+// retired keys are skipped rather than removed. `hostkey fingerprints` uses
+// it, as it may run as a different user than the server.
+func readHostKeys() error {
+	external, err := externalHostKeys()
+	if err != nil {
+		return err
+	}
+	if len(external) > 0 {
+		certs, err := loadHostCerts(external)
+		if err != nil {
+			return err
+		}
+		hostKeys = hostKeySet{current: external, certs: certs}
+		return nil
+	}
+	set, err := dataDirHostKeys(false)
+	if err != nil {
+		return err
+	}
+	hostKeys = set
+	return nil
+}
+
+// externalHostKeys returns the keys supplied by $HOST_KEY, host-key-file or
+// the secrets provider, in that order of precedence.
+func externalHostKeys() ([]hostKey, error) {
+	switch {
+	case cfg.HostKeyData != "":
+		return parseHostKeys([]byte(cfg.HostKeyData), "$HOST_KEY")
+	case cfg.HostKeyFile != "":
+		raw, err := os.ReadFile(cfg.HostKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read host key file: %w", err)
+		}
+		return parseHostKeys(raw, cfg.HostKeyFile)
+	case cfg.SecretsProvider != "":
+		provider, err := newSecretsProvider(cfg.SecretsProvider)
+		if err != nil {
+			return nil, err
+		}
+		var keys []hostKey
+		for _, typ := range cfg.HostKeyTypes {
+			name := "ssh_host_" + typ + "_key"
+			raw, err := provider.secret(name)
+			if errors.Is(err, errSecretNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			parsed, err := parseHostKeys(raw, provider.String()+"/"+name)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, parsed...)
+		}
+		if len(keys) == 0 {
+			slog.Info("No host keys found in secrets provider; using the data dir", "provider", provider.String())
+		}
+		return keys, nil
+	}
+	return nil, nil
+}
+
+// parseHostKeys reads one or more PEM private keys, or the same encoded as
+// base64, which survives environment variables better.
+func parseHostKeys(data []byte, source string) ([]hostKey, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+		if err != nil {
+			return nil, fmt.Errorf("host key from %s is neither PEM nor base64: %w", source, err)
+		}
+		data = decoded
+	}
+
+	var keys []hostKey
+	seen := make(map[string]bool)
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			break
+		}
+		data = rest
+		signer, err := gossh.ParsePrivateKey(pem.EncodeToMemory(block))
+		if err != nil {
+			return nil, fmt.Errorf("host key from %s is corrupt: %w", source, err)
+		}
+		typ, err := hostKeyType(signer.PublicKey())
+		if err != nil {
+			return nil, fmt.Errorf("host key from %s: %w", source, err)
+		}
+		if seen[typ] {
+			return nil, fmt.Errorf("%s holds more than one %s key", source, typ)
+		}
+		seen[typ] = true
+		keys = append(keys, hostKey{typ: typ, path: source, signer: signer})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no PEM private key found in %s", source)
+	}
+	return keys, nil
+}
+
+// hostKeyType maps an SSH key type to one of hostKeyTypes.
+func hostKeyType(pub gossh.PublicKey) (string, error) {
+	switch pub.Type() {
+	case gossh.KeyAlgoED25519:
+		return hostKeyEd25519, nil
+	case gossh.KeyAlgoECDSA256, gossh.KeyAlgoECDSA384, gossh.KeyAlgoECDSA521:
+		return hostKeyECDSA, nil
+	case gossh.KeyAlgoRSA:
+		return hostKeyRSA, nil
+	}
+	return "", fmt.Errorf("unsupported key type %s", pub.Type())
+}
+
+func loadHostKeysLocked() error {
+	set, err := dataDirHostKeys(true)
+	if err != nil {
+		return err
+	}
+	hostKeys = set
+	return nil
+}
+
+// dataDirHostKeys loads the keys of the configured types from the data dir
+// along with retired keys still within their grace period. With write set it
+// generates missing keys and removes expired retired ones, and the caller
+// holds the host key lock.
+func dataDirHostKeys(write bool) (hostKeySet, error) {
+	var set hostKeySet
+	for _, typ := range cfg.HostKeyTypes {
+		path := hostKeyPath(typ)
+		if write {
+			if err := ensureHostKey(typ); err != nil {
+				return set, err
+			}
+		} else if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return set, fmt.Errorf("%s host key %s not found; start the server once to generate it", typ, path)
+		}
+		signer, err := loadHostSigner(path)
+		if err != nil {
+			return set, err
+		}
+		set.current = append(set.current, hostKey{typ: typ, path: path, signer: signer})
+
+		old := path + retiredKeySuffix
+		fi, err := os.Stat(old)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return set, fmt.Errorf("failed to check for retired host key: %w", err)
+		}
+		until := fi.ModTime().Add(cfg.HostKeyGrace)
+		if !time.Now().Before(until) {
+			if write {
+				slog.Info("Grace period for retired host key is over; removing it", "path", old)
+				for _, p := range []string{old, old + ".pub"} {
+					if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+						metricHostKeyErrors.Inc()
+						slog.Warn("Failed to remove retired host key", "path", p, "err", err)
+					}
+				}
+			}
+			continue
+		}
+		signer, err = loadHostSigner(old)
+		if err != nil {
+			return set, err
+		}
+		set.retired = append(set.retired, hostKey{typ: typ, path: old, signer: signer, until: until})
+	}
+	certs, err := loadHostCerts(append(set.current, set.retired...))
+	if err != nil {
+		return set, err
+	}
+	set.certs = certs
+	return set, nil
+}
+
+// presented returns the keys used in the handshake, one per type. A type
+// with a retired key still in its grace period gets a graceSigner, so
+// known_hosts entries keep matching until it switches to the current key.
+func (h hostKeySet) presented(now time.Time) []gossh.Signer {
+	var signers []gossh.Signer
+	for _, k := range h.current {
+		var signer gossh.Signer = k.signer
+		for _, old := range h.retired {
+			if old.typ == k.typ && now.Before(old.until) {
+				signer = &graceSigner{old: old.signer, next: k.signer, until: old.until, now: time.Now}
+			}
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
+
+// graceSigner presents a retired host key until its grace period ends and
+// its successor after. The server keeps the same signer throughout, so
+// nothing changes its host keys while handshakes read them.
+type graceSigner struct {
+	old, next gossh.Signer
+	until     time.Time
+	now       func() time.Time
+
+	mu       sync.Mutex
+	switched bool
+}
+
+// current returns the key to present now.
+func (g *graceSigner) current() gossh.Signer {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.now().Before(g.until) {
+		return g.old
+	}
+	if !g.switched {
+		g.switched = true
+		slog.Info("Grace period over; now presenting new host key", "fingerprint", gossh.FingerprintSHA256(g.next.PublicKey()))
+	}
+	return g.next
+}
+
+func (g *graceSigner) PublicKey() gossh.PublicKey { return g.current().PublicKey() }
+
+func (g *graceSigner) Sign(rand io.Reader, data []byte) (*gossh.Signature, error) {
+	return g.current().Sign(rand, data)
+}
+
+// SignWithAlgorithm lets RSA keys sign with SHA-2, as gossh's own signers do.
+func (g *graceSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*gossh.Signature, error) {
+	signer := g.current()
+	if as, ok := signer.(gossh.AlgorithmSigner); ok {
+		return as.SignWithAlgorithm(rand, data, algorithm)
+	}
+	if algorithm != "" && algorithm != signer.PublicKey().Type() {
+		return nil, fmt.Errorf("host key cannot sign with %s", algorithm)
+	}
+	return signer.Sign(rand, data)
+}
+
+// announced returns every key clients should trust: the current keys plus
+// retired ones still in their grace period.
+func (h hostKeySet) announced(now time.Time) []gossh.Signer {
+	var signers []gossh.Signer
+	for _, k := range h.current {
+		signers = append(signers, k.signer)
+	}
+	for _, k := range h.retired {
+		if now.Before(k.until) {
+			signers = append(signers, k.signer)
+		}
+	}
+	return signers
+}
+
+// logFingerprints logs the SHA256 fingerprint of every loaded key.
+func (h hostKeySet) logFingerprints() {
+	for _, k := range h.current {
+		slog.Info("Host key", "type", k.signer.PublicKey().Type(), "fingerprint", gossh.FingerprintSHA256(k.signer.PublicKey()), "path", k.path)
+	}
+	for _, k := range h.retired {
+		slog.Info("Retired host key", "type", k.signer.PublicKey().Type(), "fingerprint", gossh.FingerprintSHA256(k.signer.PublicKey()),
+			"path", k.path, "until", k.until.Format(time.RFC3339))
+	}
+	for _, c := range h.certs {
+		c.logInfo()
+	}
+}
+
+// withHostKeys serves the loaded keys and certificates and answers
+// hostkeys-prove-00. Retired keys switch to their successors on their own,
+// see graceSigner.
+func withHostKeys() ssh.Option {
+	return func(srv *ssh.Server) error {
+		for _, signer := range hostKeys.presented(time.Now()) {
+			srv.AddHostKey(signer)
+		}
+		for _, c := range hostKeys.certs {
+			srv.AddHostKey(c.signer) // Keyed by the certificate type, so it joins the plain key
+		}
+		if srv.RequestHandlers == nil {
+			srv.RequestHandlers = make(map[string]ssh.RequestHandler)
+		}
+		srv.RequestHandlers[reqHostKeysProve] = proveHostKeys
+		return nil
+	}
+}
+
+// hostKeysMiddleware announces every host key once per connection, so
+// OpenSSH clients with UpdateHostKeys learn the new keys during a rotation.
+func hostKeysMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			ctx := s.Context()
+			conn, ok := ctx.Value(ssh.ContextKeyConn).(gossh.Conn)
+			if ok && ctx.Value(hostKeysSentKey) == nil {
+				ctx.SetValue(hostKeysSentKey, true)
+				var payload []byte
+				for _, signer := range hostKeys.announced(time.Now()) {
+					payload = append(payload, gossh.Marshal(struct{ Key []byte }{signer.PublicKey().Marshal()})...)
+				}
+				if _, _, err := conn.SendRequest(reqHostKeys, false, payload); err != nil {
+					sessionLog(ctx).Warn("Failed to announce host keys", "err", err)
+				}
+			}
+			next(s)
+		}
+	}
+}
+
+// proveHostKeys signs each requested key blob with the matching key,
+// proving to the client that the server holds the keys it announced.
+func proveHostKeys(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+	conn, ok := ctx.Value(ssh.ContextKeyConn).(gossh.Conn)
+	if !ok {
+		return false, nil
+	}
+	signers := make(map[string]gossh.Signer)
+	for _, signer := range hostKeys.announced(time.Now()) {
+		signers[string(signer.PublicKey().Marshal())] = signer
+	}
+
+	var reply []byte
+	rest := req.Payload
+	for len(rest) > 0 {
+		var blob struct {
+			Key  []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := gossh.Unmarshal(rest, &blob); err != nil {
+			return false, nil
+		}
+		rest = blob.Rest
+		signer, ok := signers[string(blob.Key)]
+		if !ok {
+			return false, nil
+		}
+		data := gossh.Marshal(struct {
+			Type, SessionID, Key []byte
+		}{[]byte(reqHostKeysProve), conn.SessionID(), blob.Key})
+		sig, err := signHostKeyProof(signer, data)
+		if err != nil {
+			metricHostKeyErrors.Inc()
+			sessionLog(ctx).Error("Failed to sign host key proof", "err", err)
+			return false, nil
+		}
+		reply = append(reply, gossh.Marshal(struct{ Sig []byte }{gossh.Marshal(sig)})...)
+	}
+	return true, reply
+}
+
+// signHostKeyProof signs with SHA-512 for RSA keys, as OpenSSH expects when
+// the handshake did not use RSA.
+func signHostKeyProof(signer gossh.Signer, data []byte) (*gossh.Signature, error) {
+	if as, ok := signer.(gossh.AlgorithmSigner); ok && signer.PublicKey().Type() == gossh.KeyAlgoRSA {
+		return as.SignWithAlgorithm(rand.Reader, data, gossh.KeyAlgoRSASHA512)
+	}
+	return signer.Sign(rand.Reader, data)
+}
+
+// --- CLI ---
+
+// runHostKeyCommand implements `hostkey rotate|fingerprints`.
+func runHostKeyCommand(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: hostkey rotate [-force] | hostkey fingerprints")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+	if _, err := loadConfig(nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "fingerprints":
+		if len(args) != 1 {
+			return usage()
+		}
+		if err := readHostKeys(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		hostKeys.listing().writeTo(os.Stdout)
+	case "rotate":
+		fs := flag.NewFlagSet("hostkey rotate", flag.ContinueOnError)
+		force := fs.Bool("force", false, "rotate even if the previous rotation's grace period has not ended")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 0 {
+			return usage()
+		}
+		if external, err := externalHostKeys(); err != nil || len(external) > 0 {
+			if err == nil {
+				err = fmt.Errorf("host keys come from %s; rotate them there", external[0].path)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := rotateHostKeys(*force); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Rotated host keys; the old ones stay in use for %s. Restart or send SIGHUP to pick them up.\n", cfg.HostKeyGrace)
+	default:
+		return usage()
+	}
+	return 0
+}
+
+// rotateHostKeys moves each current key aside as the retired key and
+// generates a new one in its place. The retired key's mtime marks the start
+// of its grace period.
+func rotateHostKeys(force bool) error {
+	return withHostKeyLock(func() error { return rotateHostKeysLocked(force) })
+}
+
+func rotateHostKeysLocked(force bool) error {
+	for _, typ := range cfg.HostKeyTypes {
+		path := hostKeyPath(typ)
+		old := path + retiredKeySuffix
+		if fi, err := os.Stat(old); err == nil && !force && time.Since(fi.ModTime()) < cfg.HostKeyGrace {
+			return fmt.Errorf("%s is still in its grace period; wait or use -force", old)
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if err := ensureHostKey(typ); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, suffix := range []string{"", ".pub"} {
+			if err := os.Rename(path+suffix, old+suffix); err != nil {
+				return fmt.Errorf("failed to retire host key: %w", err)
+			}
+		}
+		now := time.Now()
+		if err := os.Chtimes(old, now, now); err != nil {
+			return fmt.Errorf("failed to retire host key: %w", err)
+		}
+		if err := writeHostKey(typ, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
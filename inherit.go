@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	listenFdsStart    = 3                   // First passed descriptor, as in sd_listen_fds(3)
+	envInheritedFds   = "INHERITED_FDS"     // Set by a parent process handing over listeners
+	envInheritedNames = "INHERITED_FDNAMES" // Colon-separated, like LISTEN_FDNAMES
+)
+
+// Names a passed listener can carry; anything else is served as SSH
+const (
+	listenerSSH     = "ssh"
+	listenerHealth  = "health"
+	listenerMetrics = "metrics"
+)
+
+// --- Inherited Listeners ---
+
+// inherited holds the listeners passed in at startup until main claims
+// them, keyed by name.
+var (
+	inherited     = make(map[string][]net.Listener)
+	inheritedFrom string
+)
+
+// loadInherited picks up listening sockets passed in by systemd socket
+// activation (LISTEN_FDS for our LISTEN_PID) or by a parent process
+// (INHERITED_FDS). Either way they are descriptors 3 and up. The variables
+// are cleared so they do not leak into child processes.
+func loadInherited() error {
+	n, names, source, err := inheritedFds()
+	if err != nil || n == 0 {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		fd := listenFdsStart + i
+		name := listenerSSH
+		if i < len(names) && (names[i] == listenerHealth || names[i] == listenerMetrics) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		f.Close() // FileListener holds its own duplicate
+		if err != nil {
+			return fmt.Errorf("failed to use inherited descriptor %d: %w", fd, err)
+		}
+		inherited[name] = append(inherited[name], ln)
+	}
+	inheritedFrom = source
+	return nil
+}
+
+func inheritedFds() (n int, names []string, source string, err error) {
+	defer func() {
+		for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", envInheritedFds, envInheritedNames} {
+			os.Unsetenv(key)
+		}
+	}()
+
+	count, fdNames := "", ""
+	if v := os.Getenv("LISTEN_FDS"); v != "" {
+		// LISTEN_PID guards against variables meant for another process
+		if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+			count, fdNames, source = v, os.Getenv("LISTEN_FDNAMES"), "systemd"
+		}
+	}
+	if count == "" {
+		count, fdNames, source = os.Getenv(envInheritedFds), os.Getenv(envInheritedNames), "parent process"
+	}
+	if count == "" {
+		return 0, nil, "", nil
+	}
+	n, err = strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return 0, nil, "", fmt.Errorf("invalid inherited descriptor count %q from %s", count, source)
+	}
+	if fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+	return n, names, source, nil
+}
+
+// takeInherited hands out the inherited listeners with the given name.
+func takeInherited(name string) []net.Listener {
+	lns := inherited[name]
+	delete(inherited, name)
+	return lns
+}
+
+// setupListeners prefers inherited SSH listeners and falls back to binding
+// listen-addr itself, so the server can run unprivileged behind systemd and
+// still serve port 22.
+func setupListeners() ([]net.Listener, error) {
+	if lns := takeInherited(listenerSSH); len(lns) > 0 {
+		slog.Info("Using inherited SSH listeners; ignoring listen-addr", "listeners", len(lns), "from", inheritedFrom)
+		return lns, nil
+	}
+	return openListeners(cfg.ListenAddrs)
+}
+
+// httpListener returns the inherited health or metrics listener, or binds
+// addr. It returns nil when the endpoint is disabled.
+func httpListener(name, addr string) (net.Listener, error) {
+	if lns := takeInherited(name); len(lns) > 0 {
+		closeListeners(lns[1:])
+		return lns[0], nil
+	}
+	if addr == "" {
+		return nil, nil
+	}
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixSocketPerm lets a reverse proxy in the same group connect.
+const unixSocketPerm = 0660
+
+// --- Listeners ---
+
+// parseListenAddr maps a listen-addr entry to a network and address.
+// "unix:/path" (or a bare absolute path) is a Unix domain socket; anything
+// else is host:port. IP literals pin the family, so "[::]:22" and
+// "0.0.0.0:22" can be bound side by side.
+func parseListenAddr(addr string) (network, address string, err error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		addr = path
+	}
+	if strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, "@") {
+		return "unix", addr, nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	network = "tcp"
+	if ip := net.ParseIP(host); ip != nil {
+		network = "tcp6"
+		if ip.To4() != nil {
+			network = "tcp4"
+		}
+	}
+	return network, addr, nil
+}
+
+// listen opens one listener, replacing a stale Unix socket left behind by
+// a crash.
+func listen(addr string) (net.Listener, error) {
+	network, address, err := parseListenAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" && !strings.HasPrefix(address, "@") {
+		if fi, err := os.Stat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(address); err != nil {
+				return nil, fmt.Errorf("failed to remove stale socket %s: %w", address, err)
+			}
+		}
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if network == "unix" && !strings.HasPrefix(address, "@") {
+		if err := os.Chmod(address, unixSocketPerm); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to set permissions on %s: %w", address, err)
+		}
+	}
+	return ln, nil
+}
+
+// openListeners binds every address, closing the ones already opened if any
+// of them fails.
+func openListeners(addrs []string) ([]net.Listener, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no listen addresses configured")
+	}
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		ln, err := listen(addr)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, ln := range listeners {
+		if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Error("Failed to close listener", "addr", ln.Addr().String(), "err", err)
+		}
+	}
+}
+
+// listenerName formats a listener's address for logs.
+func listenerName(ln net.Listener) string {
+	return ln.Addr().Network() + "://" + ln.Addr().String()
+}
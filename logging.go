@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	ssh "github.com/charmbracelet/ssh"
+	wish "github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Attribute keys that carry client addresses, redacted in privacy mode
+const (
+	logKeyRemote = "remote" // host:port
+	logKeyIP     = "ip"     // IP or CIDR
+)
+
+var logFormats = []string{"text", "json"}
+
+// sessionLoggerKey stores a session's logger in its ssh.Context.
+var sessionLoggerKey = &struct{ name string }{"session-logger"}
+
+// --- Logging ---
+
+// setupLogging routes slog, and the standard log package with it, to stderr
+// in the configured format and level.
+func setupLogging(c config) {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(c.LogLevel)) // Checked by finish
+	redact := c.PrivacyMode
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		if redact {
+			a = redactAttr(groups, a)
+		}
+		// "1h0m0s" rather than nanoseconds in JSON
+		if a.Value.Kind() == slog.KindDuration {
+			return slog.String(a.Key, a.Value.Duration().String())
+		}
+		return a
+	}}
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if c.LogFormat == "json" {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// redactAttr zeroes the host bits of client addresses.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == logKeyRemote || a.Key == logKeyIP {
+		return slog.String(a.Key, redactAddr(a.Value.String()))
+	}
+	return a
+}
+
+// redactAddr anonymises the IP in an address or CIDR like anonymizeIP and
+// drops the port. Unix socket peers have no IP and are left alone.
+func redactAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if ip, bits, ok := strings.Cut(host, "/"); ok {
+		return anonymizeIP(ip) + "/" + bits
+	}
+	if net.ParseIP(host) == nil {
+		return host
+	}
+	return anonymizeIP(host)
+}
+
+// fatal logs at error level and exits, like log.Fatalf.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// newSessionLogger returns a logger carrying the fields that identify an
+// SSH session.
+func newSessionLogger(s ssh.Session) *slog.Logger {
+	key := ""
+	if pub := s.PublicKey(); pub != nil {
+		key = gossh.FingerprintSHA256(pub)
+	}
+	return slog.With(
+		"session", s.Context().SessionID(),
+		logKeyRemote, s.RemoteAddr().String(),
+		"user", s.User(),
+		"client", s.Context().ClientVersion(),
+		"key", key,
+	)
+}
+
+// sessionLog returns the session's logger, or the default logger before
+// logMiddleware has run.
+func sessionLog(ctx ssh.Context) *slog.Logger {
+	if l, ok := ctx.Value(sessionLoggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// logMiddleware attaches the session logger and logs when sessions start and
+// end. It runs first so every later middleware can use sessionLog.
+func logMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			logger := newSessionLogger(s)
+			s.Context().SetValue(sessionLoggerKey, logger)
+
+			pty, _, hasPty := s.Pty()
+			attrs := []any{"pty", hasPty}
+			if hasPty {
+				attrs = append(attrs, "term", pty.Term, "size", fmt.Sprintf("%dx%d", pty.Window.Width, pty.Window.Height))
+			}
+			if cmd := s.RawCommand(); cmd != "" {
+				attrs = append(attrs, "command", cmd)
+			}
+			logger.Info("Session started", attrs...)
+
+			start := time.Now()
+			next(s)
+			logger.Info("Session ended", "duration", time.Since(start).Round(time.Millisecond))
+		}
+	}
+}
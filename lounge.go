@@ -0,0 +1,499 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	loungeSection = "Lounge"
+
+	maxLoungeNickLen = 24
+	maxLoungeMsgLen  = 280
+	loungeRateWindow = time.Minute
+)
+
+// Outcomes of a post, used as the metric label
+const (
+	loungePosted      = "posted"
+	loungeRateLimited = "rate_limited"
+	loungeRejected    = "rejected"
+)
+
+var (
+	errLoungeClosed      = errors.New("the lounge is closed right now")
+	errLoungeRateLimited = errors.New("slow down, you're sending messages too fast")
+)
+
+var (
+	styleLoungeNick   = lipgloss.NewStyle().Bold(true)
+	styleLoungeOwner  = lipgloss.NewStyle().Bold(true).Foreground(activeTabColor)
+	styleLoungeSystem = lipgloss.NewStyle().Italic(true).Foreground(helpColor)
+)
+
+// --- Lounge Broker ---
+
+// chatMessage is one line in the lounge.
+type chatMessage struct {
+	Time   time.Time
+	Nick   string
+	Text   string
+	Owner  bool // Sent from an admin session
+	System bool // Nick changes and open/closed notices
+}
+
+// loungeMsg delivers a new message to a subscriber.
+type loungeMsg struct{ msg chatMessage }
+
+// loungeHistoryMsg replaces a subscriber's history: on subscribing, and
+// when the owner closes or reopens the lounge.
+type loungeHistoryMsg struct {
+	messages []chatMessage
+	open     bool
+}
+
+// chatRing keeps the newest messages up to its capacity.
+type chatRing struct {
+	buf   []chatMessage
+	start int
+	n     int
+}
+
+func newChatRing(size int) *chatRing {
+	return &chatRing{buf: make([]chatMessage, max(size, 1))}
+}
+
+func (r *chatRing) push(m chatMessage) {
+	if r.n < len(r.buf) {
+		r.buf[(r.start+r.n)%len(r.buf)] = m
+		r.n++
+		return
+	}
+	r.buf[r.start] = m
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+// items returns the messages oldest first.
+func (r *chatRing) items() []chatMessage {
+	out := make([]chatMessage, r.n)
+	for i := range out {
+		out[i] = r.buf[(r.start+i)%len(r.buf)]
+	}
+	return out
+}
+
+func (r *chatRing) clear() {
+	r.start, r.n = 0, 0
+}
+
+// chatFilter inspects text from a visitor, a message or a nickname, before
+// it is posted. It may rewrite the text, or reject it with an error that is
+// shown to the sender.
+type chatFilter func(info sessionInfo, text string) (string, error)
+
+// loungeFilters run in order on everything visitors post. Other filters,
+// such as a hosted moderation API, register here.
+var loungeFilters = []chatFilter{maskBlockedWords}
+
+// loungeBroker fans lounge messages out to every subscribed program and
+// keeps recent history for newcomers.
+type loungeBroker struct {
+	mu      sync.Mutex
+	open    bool
+	history *chatRing
+	subs    map[string]*programQueue
+	sent    map[string][]time.Time // Recent posts per visitor key and IP, for the rate limit
+	blocked *regexp.Regexp         // Words masked by maskBlockedWords, nil for none
+}
+
+var lounge = &loungeBroker{
+	history: newChatRing(1),
+	subs:    make(map[string]*programQueue),
+	sent:    make(map[string][]time.Time),
+}
+
+// configure applies the lounge settings from cfg.
+func (b *loungeBroker) configure(c config) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.open = c.EnableLounge
+	b.history = newChatRing(c.LoungeHistory)
+	b.blocked = nil
+	var words []string
+	for _, w := range c.LoungeBlockedWords {
+		words = append(words, regexp.QuoteMeta(w))
+	}
+	if len(words) > 0 {
+		b.blocked = regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+	}
+}
+
+// subscribe starts delivering to p, beginning with the current history.
+func (b *loungeBroker) subscribe(id string, p *tea.Program) {
+	sub := newProgramQueue(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if old, ok := b.subs[id]; ok {
+		old.close()
+	}
+	b.subs[id] = sub
+	sub.offer(loungeHistoryMsg{messages: b.history.items(), open: b.open})
+}
+
+func (b *loungeBroker) unsubscribe(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if sub, ok := b.subs[id]; ok {
+		sub.close()
+		delete(b.subs, id)
+	}
+}
+
+// publishLocked records m and queues it for every subscriber. The caller holds
+// b.mu, which keeps every subscriber's messages in the same order.
+func (b *loungeBroker) publishLocked(m chatMessage) {
+	b.history.push(m)
+	for _, sub := range b.subs {
+		sub.offer(loungeMsg{msg: m})
+	}
+}
+
+// post sends text from a session after the rate limit and filters.
+func (b *loungeBroker) post(info sessionInfo, nick, text string) error {
+	text = sanitizeChat(text, maxLoungeMsgLen)
+	if text == "" {
+		return nil
+	}
+	if !info.Admin {
+		var err error
+		if text, err = runChatFilters(info, text); err != nil {
+			metricLoungeMessages.WithLabelValues(loungeRejected).Inc()
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return errLoungeClosed
+	}
+	if !info.Admin && !b.allowLocked(info) {
+		metricLoungeMessages.WithLabelValues(loungeRateLimited).Inc()
+		return errLoungeRateLimited
+	}
+	b.publishLocked(chatMessage{Time: time.Now(), Nick: nick, Text: text, Owner: info.Admin})
+	metricLoungeMessages.WithLabelValues(loungePosted).Inc()
+	return nil
+}
+
+// allowLocked applies the limit of cfg.LoungeRatePerMinute over a sliding
+// window to the visitor's key and, so switching keys doesn't reset it, to
+// their IP. Visitors who have gone quiet are forgotten.
+func (b *loungeBroker) allowLocked(info sessionInfo) bool {
+	if cfg.LoungeRatePerMinute <= 0 {
+		return true
+	}
+	cutoff := time.Now().Add(-loungeRateWindow)
+	for key, times := range b.sent {
+		for len(times) > 0 && times[0].Before(cutoff) {
+			times = times[1:]
+		}
+		if len(times) == 0 {
+			delete(b.sent, key)
+		} else {
+			b.sent[key] = times
+		}
+	}
+	keys := []string{"ip:" + hostOnly(info.RemoteAddr)}
+	if info.Fingerprint != "" {
+		keys = append(keys, info.Fingerprint)
+	}
+	for _, key := range keys {
+		if len(b.sent[key]) >= cfg.LoungeRatePerMinute {
+			return false
+		}
+	}
+	for _, key := range keys {
+		b.sent[key] = append(b.sent[key], time.Now())
+	}
+	return true
+}
+
+// rename validates a new nickname and announces the change. Announcements
+// count towards the sender's rate limit like messages.
+func (b *loungeBroker) rename(info sessionInfo, old, nick string) (string, error) {
+	nick = sanitizeChat(nick, maxLoungeNickLen)
+	if nick == "" {
+		return old, errors.New("usage: /nick <name>")
+	}
+	if !info.Admin {
+		var err error
+		if nick, err = runChatFilters(info, nick); err != nil {
+			return old, err
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open && nick != old {
+		if !info.Admin && !b.allowLocked(info) {
+			return old, errLoungeRateLimited
+		}
+		b.publishLocked(chatMessage{Time: time.Now(), Text: old + " is now " + nick, System: true})
+	}
+	return nick, nil
+}
+
+// setOpen is the owner's kill switch. Closing clears the history on every
+// screen; reopening starts afresh.
+func (b *loungeBroker) setOpen(open bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open == open {
+		return
+	}
+	b.open = open
+	b.history.clear()
+	for _, sub := range b.subs {
+		sub.offer(loungeHistoryMsg{open: open})
+	}
+}
+
+// runChatFilters passes text through every registered filter.
+func runChatFilters(info sessionInfo, text string) (string, error) {
+	for _, filter := range loungeFilters {
+		var err error
+		if text, err = filter(info, text); err != nil {
+			return "", err
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", errors.New("message is empty")
+	}
+	return text, nil
+}
+
+// maskBlockedWords replaces the words in lounge-blocked-words with
+// asterisks.
+func maskBlockedWords(_ sessionInfo, text string) (string, error) {
+	lounge.mu.Lock()
+	re := lounge.blocked
+	lounge.mu.Unlock()
+	if re == nil {
+		return text, nil
+	}
+	return re.ReplaceAllStringFunc(text, func(w string) string {
+		return strings.Repeat("*", len([]rune(w)))
+	}), nil
+}
+
+// sanitizeChat drops control characters, so nobody can send escape
+// sequences to other terminals, and trims text to limit runes.
+func sanitizeChat(text string, limit int) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+	text = strings.TrimSpace(text)
+	if runes := []rune(text); len(runes) > limit {
+		text = string(runes[:limit])
+	}
+	return text
+}
+
+// --- Lounge Tab ---
+
+// loungeModel is one visitor's view of the lounge.
+type loungeModel struct {
+	logger   *slog.Logger
+	admin    bool // Shows the kill switch
+	nick     string
+	messages []chatMessage
+	open     bool
+	input    textinput.Model
+	typing   bool
+	vp       viewport.Model
+	status   string
+}
+
+func newLoungeModel(user string) loungeModel {
+	in := textinput.New()
+	in.Prompt = "> "
+	in.CharLimit = maxLoungeMsgLen
+	nick := sanitizeChat(user, maxLoungeNickLen)
+	if nick == "" {
+		nick = "visitor"
+	}
+	return loungeModel{nick: nick, input: in, vp: viewport.New(0, 0)}
+}
+
+// receive handles messages from the broker, whichever tab is showing.
+func (l *loungeModel) receive(msg tea.Msg) {
+	switch msg := msg.(type) {
+	case loungeHistoryMsg:
+		l.messages = msg.messages
+		l.open = msg.open
+		if !l.open {
+			l.typing = false
+			l.input.Blur()
+		}
+	case loungeMsg:
+		l.messages = append(l.messages, msg.msg)
+		if over := len(l.messages) - cfg.LoungeHistory; over > 0 {
+			l.messages = l.messages[over:]
+		}
+	}
+}
+
+func (l *loungeModel) update(msg tea.Msg, sessionID string) tea.Cmd {
+	keyMsg, isKey := msg.(tea.KeyMsg)
+	if l.typing {
+		if isKey {
+			switch keyMsg.String() {
+			case "esc":
+				l.typing = false
+				l.input.Blur()
+				return nil
+			case "enter":
+				l.send(sessionID)
+				return nil
+			}
+		}
+		var cmd tea.Cmd
+		l.input, cmd = l.input.Update(msg)
+		return cmd
+	}
+
+	if isKey {
+		switch keyMsg.String() {
+		case "enter", "i":
+			if !l.open {
+				return nil
+			}
+			l.typing = true
+			l.status = ""
+			return l.input.Focus()
+		case "x":
+			if l.admin {
+				lounge.setOpen(!l.open)
+				l.logger.Info("Admin toggled the lounge", "open", !l.open)
+				return nil
+			}
+		}
+	}
+	var cmd tea.Cmd
+	l.vp, cmd = l.vp.Update(msg)
+	return cmd
+}
+
+// send posts the input line, or runs it as a command.
+func (l *loungeModel) send(sessionID string) {
+	text := l.input.Value()
+	l.input.Reset()
+	info, _ := hub.session(sessionID)
+
+	if nick, ok := strings.CutPrefix(text, "/nick"); ok && (nick == "" || nick[0] == ' ') {
+		renamed, err := lounge.rename(info, l.nick, nick)
+		if err != nil {
+			l.status = err.Error()
+			return
+		}
+		l.nick = renamed
+		l.status = ""
+		return
+	}
+	if err := lounge.post(info, l.nick, text); err != nil {
+		l.status = err.Error()
+		if errors.Is(err, errLoungeRateLimited) {
+			l.logger.Debug("Lounge message rate limited")
+		}
+		return
+	}
+	l.status = ""
+}
+
+func (l *loungeModel) view(w, h int) string {
+	var head strings.Builder
+	head.WriteString(styleItemTitle.Render("Lounge"))
+	if l.open {
+		head.WriteString(styleItemSubtitle.Render(fmt.Sprintf("  chatting as %s • %d here", l.nick, hub.presence().Viewers)))
+	} else {
+		head.WriteString(styleItemSubtitle.Render("  closed"))
+	}
+	lines := []string{head.String()}
+	if l.status != "" {
+		lines = append(lines, styleFormError.Render(l.status))
+	}
+
+	var body string
+	switch {
+	case !l.open:
+		body = styleItemSubtitle.Render("The lounge is closed right now. Check back later!")
+	case len(l.messages) == 0:
+		body = styleItemSubtitle.Render("No messages yet. Press enter to say hi!")
+	default:
+		var b strings.Builder
+		for i, m := range l.messages {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(renderChatMessage(m, w-2))
+		}
+		body = b.String()
+	}
+
+	footer := ""
+	if l.typing {
+		l.input.Width = max(w-6, 10)
+		footer = l.input.View()
+	}
+
+	atBottom := l.vp.AtBottom() || l.vp.TotalLineCount() == 0
+	l.vp.Width = w - 1
+	l.vp.Height = max(h-len(lines)-2, 1)
+	l.vp.SetContent(body)
+	if atBottom {
+		l.vp.GotoBottom()
+	}
+	lines = append(lines, "", l.vp.View())
+	if footer != "" {
+		lines = append(lines, footer)
+	}
+	return lipgloss.NewStyle().PaddingLeft(1).MaxHeight(h).Render(strings.Join(lines, "\n"))
+}
+
+func renderChatMessage(m chatMessage, width int) string {
+	stamp := styleItemSubtitle.Render(m.Time.Format("15:04") + " ")
+	if m.System {
+		return stamp + styleLoungeSystem.Render(m.Text)
+	}
+	nick := styleLoungeNick.Render(m.Nick)
+	if m.Owner {
+		nick = styleLoungeOwner.Render(m.Nick + " (owner)")
+	}
+	prefix := stamp + nick + ": "
+	text := lipgloss.NewStyle().Width(max(width-lipgloss.Width(prefix), 10)).Render(m.Text)
+	return lipgloss.JoinHorizontal(lipgloss.Top, prefix, text)
+}
+
+func (l *loungeModel) help() string {
+	if l.typing {
+		return "enter: send • /nick <name>: rename • esc: stop typing"
+	}
+	if l.admin {
+		return "←/→: switch • enter: chat • ↑/↓: scroll • x: open/close lounge • q: quit"
+	}
+	return "←/→: switch • enter: chat • ↑/↓: scroll • q: quit"
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testLounge returns an open lounge allowing two messages a minute.
+func testLounge(t *testing.T) *loungeBroker {
+	t.Helper()
+	setTestConfig(t, config{EnableLounge: true, LoungeHistory: 10, LoungeRatePerMinute: 2})
+	b := &loungeBroker{subs: make(map[string]*programQueue), sent: make(map[string][]time.Time)}
+	b.configure(cfg)
+	return b
+}
+
+func TestLoungeRateLimit(t *testing.T) {
+	b := testLounge(t)
+	info := sessionInfo{Fingerprint: "SHA256:a", RemoteAddr: "192.0.2.1:1234"}
+	for i := range 2 {
+		if err := b.post(info, "a", "hi"); err != nil {
+			t.Fatalf("message %d: %v", i+1, err)
+		}
+	}
+	if err := b.post(info, "a", "hi"); err != errLoungeRateLimited {
+		t.Errorf("got %v, want errLoungeRateLimited", err)
+	}
+
+	// A new key from the same address is still limited
+	other := sessionInfo{Fingerprint: "SHA256:b", RemoteAddr: "192.0.2.1:5678"}
+	if err := b.post(other, "b", "hi"); err != errLoungeRateLimited {
+		t.Errorf("got %v for a new key from the same IP, want errLoungeRateLimited", err)
+	}
+	// Other visitors and the owner are not
+	if err := b.post(sessionInfo{Fingerprint: "SHA256:c", RemoteAddr: "192.0.2.2:1"}, "c", "hi"); err != nil {
+		t.Errorf("another visitor: %v", err)
+	}
+	if err := b.post(sessionInfo{RemoteAddr: "192.0.2.1:1", Admin: true}, "owner", "hi"); err != nil {
+		t.Errorf("owner: %v", err)
+	}
+
+	// Visitors who have gone quiet are forgotten
+	b.sent["ip:192.0.2.1"][0] = time.Now().Add(-2 * loungeRateWindow)
+	if err := b.post(other, "b", "hi"); err != nil {
+		t.Errorf("after the window: %v", err)
+	}
+}
+
+func TestLoungeRenameRateLimit(t *testing.T) {
+	b := testLounge(t)
+	info := sessionInfo{RemoteAddr: "192.0.2.1:1234"}
+	nick := "a"
+	for _, next := range []string{"b", "c"} {
+		got, err := b.rename(info, nick, next)
+		if err != nil || got != next {
+			t.Fatalf("rename to %q: got %q, %v", next, got, err)
+		}
+		nick = got
+	}
+	got, err := b.rename(info, nick, "d")
+	if err != errLoungeRateLimited || got != nick {
+		t.Errorf("got %q, %v; want to stay %q with errLoungeRateLimited", got, err, nick)
+	}
+	if err := b.post(info, nick, "hi"); err != errLoungeRateLimited {
+		t.Errorf("got %v for a message after the renames, want errLoungeRateLimited", err)
+	}
+
+	// Only announced changes count
+	if got, err := b.rename(info, nick, nick); err != nil || got != nick {
+		t.Errorf("keeping the nick: got %q, %v", got, err)
+	}
+	items := b.history.items()
+	if len(items) != 2 || items[1].Text != "b is now c" || !items[1].System {
+		t.Errorf("got history %+v", items)
+	}
+}
@@ -1,18 +1,18 @@
 package main
 
 import (
-	"crypto/ed25519"
-	"crypto/rand"
-	"encoding/pem"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/charmbracelet/bubbles/list"
@@ -22,52 +22,42 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	ssh "github.com/charmbracelet/ssh"
 	wish "github.com/charmbracelet/wish"
-	"github.com/charmbracelet/wish/activeterm"
 	wb "github.com/charmbracelet/wish/bubbletea"
-	wl "github.com/charmbracelet/wish/logging"
+	"github.com/muesli/termenv"
 	gossh "golang.org/x/crypto/ssh"
 )
 
-// --- Constants ---
-const (
-	keyDir         = "/data"
-	privateKeyPath = keyDir + "/ssh_host_ed25519_key"
-	publicKeyPath  = keyDir + "/ssh_host_ed25519_key.pub"
-	defaultPort    = "22"
-	devPort        = "23234"
-)
-
 // --- Data Structs ---
 
 type educationItem struct {
-	School  string
-	Status  string
-	Dates   string
-	Details []string
+	School  string   `json:"school"`
+	Status  string   `json:"status,omitempty"`
+	Dates   string   `json:"dates,omitempty"`
+	Details []string `json:"details,omitempty"`
 }
 
 type experienceItem struct {
-	Company     string
-	Dates       string
-	Role        string
-	Location    string
-	Reporting   string
-	Description []string
+	Company     string   `json:"company"`
+	Dates       string   `json:"dates,omitempty"`
+	Role        string   `json:"role"`
+	Location    string   `json:"location,omitempty"`
+	Reporting   string   `json:"reporting,omitempty"`
+	Description []string `json:"description,omitempty"`
 }
 
 type projectItem struct {
-	Name        string
-	Dates       string
-	Description []string
+	Name        string   `json:"name"`
+	Dates       string   `json:"dates,omitempty"`
+	Description []string `json:"description,omitempty"`
 }
 
 type skillsItem struct {
-	Category string
-	Details  []string
+	Category string   `json:"category"`
+	Details  []string `json:"details"`
 }
 
 type contactItem struct {
-	Line string
+	Line string `json:"line"`
 }
 
 // Interface for list items
@@ -84,6 +74,8 @@ func (c contactItem) FilterValue() string    { return c.Line }
 
 // --- Updated Résumé Data ---
 
+// resumeData is the built-in content, served until an edited copy is saved
+// to cfg.ContentPath.
 var resumeData = map[string][]listItemData{
 	"Education": {
 		educationItem{
@@ -230,6 +222,9 @@ var sectionOrder = []string{
 	"Projects",
 	"Skills & Interests",
 	"Contact",
+	guestbookSection,
+	loungeSection,
+	serverSection,
 }
 
 // --- Bubbles list.Item wrapper ---
@@ -256,6 +251,31 @@ var (
 	styleNormal = lipgloss.NewStyle().PaddingLeft(2)
 )
 
+// theme is a colour palette selectable with the theme setting.
+type theme struct {
+	accent lipgloss.Color // Active tab, selection and spinner
+	header lipgloss.Color // Title above the tabs
+}
+
+var themes = map[string]theme{
+	"green": {accent: "78", header: "213"},
+	"blue":  {accent: "39", header: "219"},
+	"amber": {accent: "214", header: "203"},
+	"mono":  {accent: "255", header: "252"},
+}
+
+// applyTheme recolours the shared styles; call it once before serving.
+func applyTheme(name string) {
+	t := themes[name]
+	activeTabColor = t.accent
+	styleSelectedBorder = styleSelectedBorder.BorderForeground(t.accent)
+	styleTabActive = styleTabActive.Foreground(t.accent)
+	styleHeaderText = styleHeaderText.Foreground(t.header)
+	styleAdminPanelActive = styleAdminPanelActive.Foreground(t.accent)
+	styleEditorCursor = styleEditorCursor.Foreground(t.accent)
+	styleFormFocused = styleFormFocused.Foreground(t.accent)
+}
+
 type itemDelegate struct{}
 
 // Use a larger fixed Height, plus Spacing between items
@@ -350,20 +370,38 @@ const (
 
 type loadedMsg struct{}
 
+// adminTickMsg refreshes the admin tab while it is open.
+type adminTickMsg struct{}
+
 type model struct {
-	s       state
-	spin    spinner.Model
-	w, h    int
-	active  int // active tab index (index into sectionOrder)
-	lst     list.Model
-	vp      viewport.Model
-	gotSize bool
+	s          state
+	spin       spinner.Model
+	w, h       int
+	active     int      // active tab index (index into sections)
+	sections   []string // tabs visible to this session
+	lst        list.Model
+	vp         viewport.Model
+	gotSize    bool
+	sessionID  string
+	logger     *slog.Logger // carries the session's identifying fields
+	admin      bool
+	adm        adminModel
+	data       map[string][]listItemData // this session's snapshot of the résumé
+	editor     *editorModel              // non-nil while an admin edits a section
+	gb         guestbookModel
+	lounge     loungeModel
+	contact    contactModel
+	shutdownAt time.Time // set once the server starts draining
+	started    time.Time
+	lastInput  time.Time // for the idle timeout
+	goodbye    string    // why the session is closing, once timed out
+	presence   presenceMsg
 }
 
 func newModel() *model {
 	sp := spinner.New()
-	sp.Spinner = spinner.Pulse                                      // Try pulse spinner
-	sp.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("78")) // Use the active green color
+	sp.Spinner = spinner.Pulse                                // Try pulse spinner
+	sp.Style = lipgloss.NewStyle().Foreground(activeTabColor) // Use the theme's accent color
 	vp := viewport.New(0, 0)
 
 	// Initialize list model here with defaults to prevent nil pointer panic
@@ -375,7 +413,18 @@ func newModel() *model {
 	lst.Title = ""
 	lst.Styles.Title = lipgloss.NewStyle()
 
-	return &model{s: splash, spin: sp, vp: vp, lst: lst} // Assign initialized list
+	var sections []string
+	for _, section := range sectionOrder {
+		if section == guestbookSection && !cfg.EnableGuestbook {
+			continue
+		}
+		if section == loungeSection && !cfg.EnableLounge {
+			continue
+		}
+		sections = append(sections, section)
+	}
+	now := time.Now()
+	return &model{s: splash, spin: sp, vp: vp, lst: lst, sections: sections, adm: newAdminModel(), data: content.snapshot(), started: now, lastInput: now} // Assign initialized list
 }
 
 func (m *model) setSize(w, h int) {
@@ -400,7 +449,7 @@ func (m *model) setSize(w, h int) {
 
 func (m *model) buildSkillsContent() string {
 	var skillsBuilder strings.Builder
-	skillsData, _ := resumeData["Skills & Interests"]
+	skillsData, _ := m.data["Skills & Interests"]
 
 	contentWidth := m.vp.Width - styleItemDesc.GetHorizontalPadding()
 	if contentWidth < 0 {
@@ -430,10 +479,10 @@ func (m *model) Init() tea.Cmd {
 		m.spin.Tick,
 		func() tea.Msg {
 			// Longer delay for splash animation
-			// time.Sleep(600 * time.Millisecond) // Old duration
-			time.Sleep(3 * time.Second) // Set duration to 3 seconds
+			time.Sleep(cfg.SplashDuration)
 			return loadedMsg{}
 		},
+		m.checkTimeouts(),
 	)
 }
 
@@ -441,10 +490,33 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	var cmd tea.Cmd
 
+	if m.goodbye != "" {
+		// Only resizing and leaving early still do anything
+		switch msg := msg.(type) {
+		case tea.WindowSizeMsg:
+			m.setSize(msg.Width, msg.Height)
+		case tea.KeyMsg:
+			if msg.String() == "q" || msg.String() == "ctrl+c" {
+				return m, tea.Quit
+			}
+		case goodbyeDoneMsg:
+			return m, tea.Quit
+		}
+		return m, nil
+	}
+
 	switch msg := msg.(type) {
+	case tea.KeyMsg, tea.MouseMsg:
+		m.lastInput = time.Now()
+
+	case sessionTimeoutMsg:
+		return m, m.checkTimeouts()
+
 	case tea.WindowSizeMsg:
 		m.setSize(msg.Width, msg.Height)
-		if m.s == mainUI && sectionOrder[m.active] == "Skills & Interests" {
+		analytics.resized(m.sessionID, msg.Width, msg.Height)
+		recordings.resized(m.sessionID, msg.Width, msg.Height)
+		if m.s == mainUI && m.sections[m.active] == "Skills & Interests" {
 			m.vp.SetContent(m.buildSkillsContent())
 		}
 
@@ -452,40 +524,89 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.gotSize {
 			m.enterMain()
 		}
+
+	case presenceMsg:
+		m.presence = msg
+		return m, nil
+
+	case contentReloadedMsg:
+		m.data = content.snapshot()
+		if m.s == mainUI {
+			m.rebuildList()
+		}
+		return m, nil
+
+	case shutdownMsg:
+		m.shutdownAt = msg.at
+		return m, shutdownTick()
+
+	case shutdownTickMsg:
+		if time.Now().Before(m.shutdownAt) {
+			return m, shutdownTick()
+		}
+		return m, nil
+
+	case adminTickMsg:
+		if m.s == mainUI && m.sections[m.active] == adminSection {
+			return m, adminTick()
+		}
+		return m, nil
+
+	case replayTickMsg:
+		// Delivered whichever tab is showing, so playback keeps its place
+		return m, m.adm.update(msg)
+
+	case loungeMsg, loungeHistoryMsg:
+		// Kept up to date on every tab so switching shows the whole conversation
+		m.lounge.receive(msg)
+		return m, nil
 	}
 
 	if m.s == mainUI {
-		activeSection := sectionOrder[m.active]
+		activeSection := m.sections[m.active]
+
+		if m.editor != nil {
+			// The editor owns the keyboard so typing doesn't switch tabs
+			if keyMsg, ok := msg.(tea.KeyMsg); ok && keyMsg.String() == "ctrl+c" {
+				return m, tea.Quit
+			}
+			done, cmd := m.editor.update(msg)
+			if done {
+				m.editor = nil
+				m.rebuildList()
+			}
+			return m, cmd
+		}
+		if m.formOpen() {
+			// Same for forms, so visitors can type freely
+			if keyMsg, ok := msg.(tea.KeyMsg); ok && keyMsg.String() == "ctrl+c" {
+				return m, tea.Quit
+			}
+			return m, m.updateSection(msg)
+		}
 
 		if keyMsg, ok := msg.(tea.KeyMsg); ok {
 			switch keyMsg.String() {
 			case "q", "ctrl+c":
 				return m, tea.Quit
+			case "e":
+				if _, editable := editorFields[activeSection]; editable && m.admin {
+					m.editor = newEditorModel(activeSection, m.data[activeSection])
+					return m, nil
+				}
 			case "left", "h":
-				m.active = (m.active - 1 + len(sectionOrder)) % len(sectionOrder)
-				m.rebuildList()
-				return m, nil
+				return m, m.switchTab((m.active - 1 + len(m.sections)) % len(m.sections))
 			case "right", "l":
-				m.active = (m.active + 1) % len(sectionOrder)
-				m.rebuildList()
-				return m, nil
-			case "1", "2", "3", "4", "5":
+				return m, m.switchTab((m.active + 1) % len(m.sections))
+			case "1", "2", "3", "4", "5", "6", "7", "8", "9":
 				idx, err := strconv.Atoi(keyMsg.String())
-				if err == nil && idx >= 1 && idx <= len(sectionOrder) {
-					m.active = idx - 1
-					m.rebuildList()
-					return m, nil
+				if err == nil && idx >= 1 && idx <= len(m.sections) {
+					return m, m.switchTab(idx - 1)
 				}
 			}
 		}
 
-		if activeSection == "Skills & Interests" {
-			m.vp, cmd = m.vp.Update(msg)
-			cmds = append(cmds, cmd)
-		} else if activeSection != "Contact" {
-			m.lst, cmd = m.lst.Update(msg)
-			cmds = append(cmds, cmd)
-		}
+		cmds = append(cmds, m.updateSection(msg))
 	}
 
 	if m.s == splash {
@@ -493,22 +614,92 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, cmd)
 	}
 
+	// Keep what visitors type into forms out of recordings
+	private := m.gb.form != nil || m.contact.form != nil
+	if recordings.pause(m.sessionID, private) && !private {
+		cmds = append(cmds, tea.ClearScreen)
+	}
+
 	return m, tea.Batch(cmds...)
 }
 
+// updateSection forwards msg to the component behind the active tab.
+func (m *model) updateSection(msg tea.Msg) tea.Cmd {
+	var cmd tea.Cmd
+	switch activeSection := m.sections[m.active]; activeSection {
+	case adminSection:
+		cmd = m.adm.update(msg)
+	case guestbookSection:
+		cmd = m.gb.update(msg, m.sessionID)
+	case loungeSection:
+		cmd = m.lounge.update(msg, m.sessionID)
+	case "Contact":
+		cmd = m.contact.update(msg, m.sessionID)
+	case "Skills & Interests", serverSection:
+		m.vp, cmd = m.vp.Update(msg)
+	default:
+		m.lst, cmd = m.lst.Update(msg)
+	}
+	return cmd
+}
+
+// formOpen reports whether a form, or the admin replay viewer, on the
+// active tab owns the keyboard.
+func (m *model) formOpen() bool {
+	switch m.sections[m.active] {
+	case guestbookSection:
+		return m.gb.form != nil
+	case loungeSection:
+		return m.lounge.typing
+	case "Contact":
+		return m.contact.form != nil
+	case adminSection:
+		return m.adm.form != nil || m.adm.replay != nil
+	}
+	return false
+}
+
 func (m *model) enterMain() {
 	m.s = mainUI
 	m.rebuildList()
+	m.recordTab()
+}
+
+// switchTab makes idx the active tab and records it with the hub.
+func (m *model) switchTab(idx int) tea.Cmd {
+	m.active = idx
+	m.rebuildList()
+	m.recordTab()
+	metricTabSwitches.WithLabelValues(m.sections[m.active]).Inc()
+	if m.sections[m.active] == adminSection {
+		return adminTick()
+	}
+	return nil
+}
+
+// recordTab tells the hub and analytics which tab the visitor is looking at.
+func (m *model) recordTab() {
+	hub.setTab(m.sessionID, m.sections[m.active])
+	analytics.tabViewed(m.sessionID, m.sections[m.active])
+}
+
+func adminTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return adminTickMsg{} })
 }
 
 func (m *model) rebuildList() {
-	activeSection := sectionOrder[m.active]
+	activeSection := m.sections[m.active]
 	if activeSection == "Skills & Interests" {
 		if m.gotSize {
 			m.vp.SetContent(m.buildSkillsContent())
 			m.vp.GotoTop()
 		}
-	} else if activeSection != "Contact" {
+	} else if activeSection == serverSection {
+		if m.gotSize {
+			m.vp.SetContent(aboutServerView(m.w))
+			m.vp.GotoTop()
+		}
+	} else if activeSection != "Contact" && activeSection != adminSection && activeSection != guestbookSection && activeSection != loungeSection {
 		idx := 0
 		if m.lst.Items() != nil && len(m.lst.Items()) > 0 {
 			idx = m.lst.Index()
@@ -527,11 +718,11 @@ func (m *model) rebuildList() {
 }
 
 func (m *model) newList() list.Model {
-	activeSectionTitle := sectionOrder[m.active]
+	activeSectionTitle := m.sections[m.active]
 
 	var listItems []list.Item
 	if activeSectionTitle != "Skills & Interests" && activeSectionTitle != "Contact" {
-		itemsData, exists := resumeData[activeSectionTitle]
+		itemsData, exists := m.data[activeSectionTitle]
 		if exists {
 			listItems = make([]list.Item, len(itemsData))
 			for i, data := range itemsData {
@@ -605,6 +796,8 @@ var (
 )
 
 func (m *model) View() string {
+	defer observeRender(time.Now())
+
 	if !m.gotSize {
 		return "Initializing..."
 	}
@@ -620,6 +813,10 @@ func (m *model) View() string {
 		return lipgloss.Place(m.w, m.h, lipgloss.Center, lipgloss.Center, warningMsg)
 	}
 
+	if m.goodbye != "" {
+		return m.goodbyeView()
+	}
+
 	if m.s == splash {
 		// Changed splash text
 		introText := " Liem Luttrell - Portfolio"
@@ -630,21 +827,15 @@ func (m *model) View() string {
 	}
 
 	// --- Render Static Parts (Only if width is sufficient) ---
-	headerText := "Liem Luttrell - SSH Portfolio"
-	renderedHeader := styleHeaderText.Render(headerText)
+	renderedHeader := m.headerView()
 	headerHeight := lipgloss.Height(renderedHeader)
 
-	var renderedTabStrings []string
 	separator := lipgloss.NewStyle().Foreground(inactiveTabFg).Render(" | ")
-	for i, title := range sectionOrder {
-		style := styleTabInactive
-		if i == m.active {
-			style = styleTabActive
-		}
-		tabTitle := fmt.Sprintf("%d. %s", i+1, title)
-		renderedTabStrings = append(renderedTabStrings, style.Render(tabTitle))
+	joinedTabs := m.renderTabs(separator, false)
+	if lipgloss.Width(joinedTabs) > m.w {
+		// Too many tabs for this width: only spell out the active one
+		joinedTabs = m.renderTabs(separator, true)
 	}
-	joinedTabs := strings.Join(renderedTabStrings, separator)
 	remainingWidth := m.w - lipgloss.Width(joinedTabs)
 	if remainingWidth < 0 {
 		remainingWidth = 0
@@ -657,7 +848,26 @@ func (m *model) View() string {
 	separatorLineHeight := 1
 
 	// Remove the width display from the help text
-	helpView := styleHelp.Render("←/→ or h/l: switch • ↑/↓: navigate • q: quit")
+	helpText := "←/→ or h/l: switch • ↑/↓: navigate • q: quit"
+	if m.editor != nil {
+		helpText = m.editor.help()
+	} else if m.sections[m.active] == guestbookSection {
+		helpText = m.gb.help()
+	} else if m.sections[m.active] == loungeSection {
+		helpText = m.lounge.help()
+	} else if m.sections[m.active] == "Contact" && (m.contact.form != nil || !m.admin) {
+		helpText = m.contact.help()
+	} else if m.sections[m.active] == adminSection {
+		helpText = m.adm.help()
+	} else if m.admin {
+		helpText = "←/→ or h/l: switch • ↑/↓: navigate • e: edit • q: quit"
+	}
+	helpView := styleHelp.Render(helpText)
+	if !m.shutdownAt.IsZero() {
+		helpView = shutdownBanner(m.shutdownAt, m.w)
+	} else if banner := m.timeoutBanner(m.w); banner != "" {
+		helpView = banner
+	}
 	helpViewHeight := 1
 
 	// --- Calculate Content Area Dimensions ---
@@ -669,17 +879,38 @@ func (m *model) View() string {
 
 	// --- Render Content Area (Conditional) ---
 	var contentView string
-	activeSectionTitle := sectionOrder[m.active]
+	activeSectionTitle := m.sections[m.active]
+
+	if m.editor != nil {
+		contentView = m.editor.view(contentWidth, contentHeight)
+
+	} else if activeSectionTitle == adminSection {
+		contentView = m.adm.view(contentWidth, contentHeight)
 
-	if activeSectionTitle == "Contact" {
+	} else if activeSectionTitle == guestbookSection {
+		contentView = m.gb.view(contentWidth, contentHeight)
+
+	} else if activeSectionTitle == loungeSection {
+		contentView = m.lounge.view(contentWidth, contentHeight)
+
+	} else if activeSectionTitle == "Contact" && m.contact.form != nil {
+		contentView = lipgloss.NewStyle().PaddingLeft(1).MaxHeight(contentHeight).Render(m.contact.form.view(contentWidth - 4))
+
+	} else if activeSectionTitle == "Contact" {
 		// Special rendering for Contact tab
-		contactData, _ := resumeData["Contact"]
+		contactData, _ := m.data["Contact"]
 		var contactLines []string
 		for _, itemData := range contactData {
 			if contactItem, ok := itemData.(contactItem); ok {
 				contactLines = append(contactLines, contactItem.Line)
 			}
 		}
+		if cfg.EnableContactForm {
+			contactLines = append(contactLines, "", styleItemSubtitle.Render("Press m to send me a message"))
+		}
+		if m.contact.status != "" {
+			contactLines = append(contactLines, styleFormFocused.Render(m.contact.status))
+		}
 		contactBlockStr := strings.Join(contactLines, "\n")
 		styledContactBlock := styleContactBlock.Render(contactBlockStr)
 		contentView = lipgloss.Place(contentWidth, contentHeight, lipgloss.Center, lipgloss.Center, styledContactBlock)
@@ -692,6 +923,11 @@ func (m *model) View() string {
 		}
 		contentView = m.vp.View()
 
+	} else if activeSectionTitle == serverSection {
+		m.vp.Width = contentWidth
+		m.vp.Height = contentHeight
+		contentView = lipgloss.NewStyle().PaddingLeft(1).Render(m.vp.View())
+
 	} else {
 		m.lst.SetSize(contentWidth, contentHeight)
 		contentView = m.lst.View()
@@ -711,6 +947,24 @@ func (m *model) View() string {
 	)
 }
 
+// renderTabs renders the tab titles; compact mode shows only the number of
+// inactive tabs.
+func (m *model) renderTabs(separator string, compact bool) string {
+	var renderedTabStrings []string
+	for i, title := range m.sections {
+		style := styleTabInactive
+		if i == m.active {
+			style = styleTabActive
+		}
+		tabTitle := fmt.Sprintf("%d. %s", i+1, title)
+		if compact && i != m.active {
+			tabTitle = strconv.Itoa(i + 1)
+		}
+		renderedTabStrings = append(renderedTabStrings, style.Render(tabTitle))
+	}
+	return strings.Join(renderedTabStrings, separator)
+}
+
 // --- Wish boilerplate ---
 
 func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
@@ -722,6 +976,17 @@ func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 
 	// Create model *after* potentially getting PTY dims
 	m := newModel()
+	m.sessionID = s.Context().SessionID()
+	m.logger = sessionLog(s.Context())
+	m.adm.logger = m.logger
+	m.lounge = newLoungeModel(s.User())
+	m.lounge.logger = m.logger
+	if info, ok := hub.session(m.sessionID); ok && info.Admin && cfg.EnableAdmin {
+		m.admin = true
+		m.lounge.admin = true
+		m.sections = append(m.sections, adminSection)
+	}
+	m.presence = hub.presence()
 	// Initial dimensions might be 0, wait for WindowSizeMsg
 	m.w = pty.Window.Width
 	m.h = pty.Window.Height
@@ -729,105 +994,230 @@ func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 		m.gotSize = true // Mark size as received if PTY provided it
 	}
 
-	// Use AltScreen and potentially Mouse
-	opts := []tea.ProgramOption{tea.WithAltScreen(), tea.WithMouseCellMotion()}
+	// Use AltScreen and potentially Mouse. Signals are the server's to handle,
+	// otherwise SIGTERM would end every session before it can drain.
+	opts := []tea.ProgramOption{tea.WithAltScreen(), tea.WithMouseCellMotion(), tea.WithoutSignalHandler()}
 	return m, opts
 }
 
-// ensureHostKey checks if the host key pair exists, generating it if necessary.
-func ensureHostKey() error {
-	// Ensure the key directory exists
-	if err := os.MkdirAll(keyDir, 0700); err != nil {
-		return fmt.Errorf("failed to create key directory %s: %w", keyDir, err)
-	}
-
-	// Check if private key exists
-	_, err := os.Stat(privateKeyPath)
-	if err == nil {
-		// Key already exists, no action needed
+// programHandler builds the session's tea.Program and attaches it to the hub
+// so other sessions can push messages to it.
+func programHandler(s ssh.Session) *tea.Program {
+	m, opts := teaHandler(s)
+	if m == nil {
 		return nil
 	}
-
-	// If error is something other than "does not exist", return it
-	if !errors.Is(err, os.ErrNotExist) {
-		return fmt.Errorf("failed to check for host key: %w", err)
+	opts = append(opts, wb.MakeOptions(s)...)
+	// Sessions use an emulated PTY, so the program writes to s and the
+	// recorder can sit in between
+	if info, ok := hub.session(s.Context().SessionID()); ok {
+		if rec := recordings.start(s, info); rec != nil {
+			opts = append(opts, tea.WithOutput(recordedOutput{Writer: s, rec: rec}))
+		}
 	}
-
-	// Key does not exist, generate a new one
-	log.Printf("Host key not found at %s. Generating new key pair...", privateKeyPath)
-
-	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
-	if err != nil {
-		return fmt.Errorf("failed to generate key pair: %w", err)
+	p := tea.NewProgram(m, opts...)
+	hub.attach(s.Context().SessionID(), p)
+	if cfg.EnableLounge {
+		lounge.subscribe(s.Context().SessionID(), p)
 	}
+	return p
+}
 
-	// Convert the ed25519 private key to a format ssh.MarshalPrivateKey understands.
-	// The golang.org/x/crypto/ssh package handles this conversion internally
-	// when parsing, but marshalling requires the specific type.
-	// We need to use the PEM block structure recognised by OpenSSH.
-	opensshPrivKey, err := gossh.MarshalPrivateKey(privKey, "") // Use aliased package
-	if err != nil {
-		return fmt.Errorf("failed to marshal private key: %w", err)
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "healthcheck":
+			os.Exit(runHealthcheck(args[1:]))
+		case "config":
+			os.Exit(runConfigCommand(args[1:]))
+		case "ban":
+			os.Exit(runBanCommand(args[1:]))
+		case "hostkey":
+			os.Exit(runHostKeyCommand(args[1:]))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+			os.Exit(2)
+		}
 	}
 
-	// Write private key file (ensure correct permissions)
-	err = ioutil.WriteFile(privateKeyPath, pem.EncodeToMemory(opensshPrivKey), 0600) // Read/Write for owner only
-	if err != nil {
-		return fmt.Errorf("failed to write private key: %w", err)
+	// Defaults, then the config file, then env, then flags
+	if _, err := loadConfig(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fatal("Invalid configuration", "err", err)
+	}
+	setupLogging(cfg)
+	applyTheme(cfg.Theme)
+	admins.path = cfg.AdminKeysPath
+	content.path = cfg.ContentPath
+	guestbook.path = cfg.GuestbookPath
+	contactOutbox.dir = cfg.OutboxDir
+	recordings.dir = cfg.RecordingsDir
+	lounge.configure(cfg)
+
+	// Sockets from systemd or from the process we are upgrading
+	if err := loadInherited(); err != nil {
+		fatal("Could not use inherited listeners", "err", err)
 	}
-	log.Printf("Wrote private host key to %s", privateKeyPath)
 
-	// Generate public key bytes in authorized_keys format
-	sshPubKey, err := gossh.NewPublicKey(pubKey) // Use aliased package
+	// Liveness and readiness probes
+	healthLn, err := httpListener(listenerHealth, cfg.HealthAddr)
 	if err != nil {
-		return fmt.Errorf("failed to create ssh public key: %w", err)
+		slog.Error("Health server failed", "err", err)
+	} else if healthLn != nil {
+		go serveHealth(healthLn)
 	}
-	pubKeyBytes := gossh.MarshalAuthorizedKey(sshPubKey) // Use aliased package
 
-	// Write public key file
-	err = ioutil.WriteFile(publicKeyPath, pubKeyBytes, 0644) // Read for all, write for owner
+	// Optional Prometheus endpoint, e.g. metrics-addr=:9090
+	metricsLn, err := httpListener(listenerMetrics, cfg.MetricsAddr)
 	if err != nil {
-		// Attempt to clean up private key if public key write fails
-		_ = os.Remove(privateKeyPath)
-		return fmt.Errorf("failed to write public key: %w", err)
+		slog.Error("Metrics server failed", "err", err)
+	} else if metricsLn != nil {
+		go serveMetrics(metricsLn)
 	}
-	log.Printf("Wrote public host key to %s", publicKeyPath)
 
-	return nil
-}
+	// Ensure host keys exist or generate new ones
+	if err := loadHostKeys(); err != nil {
+		fatal("Failed to load host keys", "err", err)
+	}
+	hostKeys.logFingerprints()
 
-func main() {
-	// Determine port based on DEV_MODE environment variable
-	port := defaultPort
-	if os.Getenv("DEV_MODE") != "" {
-		port = devPort
-		log.Println("DEV_MODE detected, using development port:", port)
-	} else {
-		log.Println("Using default port:", port)
+	// Load edited résumé content, if any
+	if err := content.load(); err != nil {
+		fatal("Failed to load content", "err", err)
+	}
+	ready.set(checkContent)
+	if cfg.EnableGuestbook {
+		if err := guestbook.load(); err != nil {
+			fatal("Failed to load guestbook", "err", err)
+		}
 	}
 
-	// Ensure host key exists or generate a new one
-	if err := ensureHostKey(); err != nil {
-		log.Fatalf("Failed to ensure host key: %v", err)
+	// Record visits under the data dir
+	if err := analyticsFromConfig(cfg); err != nil {
+		fatal("Failed to open analytics", "err", err)
+	}
+	go analytics.runPruner()
+	if cfg.EnableRecording {
+		go recordings.runPruner()
 	}
 
-	// Use the generated/existing host key
-	hostKeyOpt := wish.WithHostKeyPath(privateKeyPath)
+	// Keep scanners and bots from hogging sessions
+	limits.configure(cfg)
+	go limits.runSweeper()
+	bans.path = cfg.BansPath
+	if err := bans.load(); err != nil {
+		fatal("Could not load bans", "err", err)
+	}
+	go bans.runSweeper()
+
+	// Deliver "send me a message" submissions in the background
+	ctx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	if cfg.EnableContactForm {
+		contactOutbox.sender = senderFromConfig(cfg)
+		go contactOutbox.run(ctx)
+	}
 
 	srv, err := wish.NewServer(
-		wish.WithAddress(net.JoinHostPort("0.0.0.0", port)), // Use determined port
-		hostKeyOpt, // Use the host key option
+		withHostKeys(),
+		withBanHooks(),
+		// Accept every key so the owner can be recognised by theirs; keyless
+		// clients fall back to keyboard-interactive, which is also accepted.
+		wish.WithPublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+			return true
+		}),
+		wish.WithKeyboardInteractiveAuth(func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+			return true
+		}),
 		wish.WithMiddleware(
-			wb.Middleware(teaHandler),
-			activeterm.Middleware(),
-			wl.Middleware(),
+			wb.MiddlewareWithProgramHandler(programHandler, termenv.Ascii),
+			sessionMiddleware(),
+			ptyMiddleware(),
+			probeMiddleware(),
+			execMiddleware(),
+			hostKeysMiddleware(),
+			metricsMiddleware(),
+			rateLimitMiddleware(),
+			logMiddleware(),
 		),
 	)
 	if err != nil {
-		log.Fatalf("Could not create server: %v", err)
+		fatal("Could not create server", "err", err)
+	}
+	ready.set(checkHostKey)
+
+	listeners, err := setupListeners()
+	if err != nil {
+		fatal("Could not listen", "err", err)
+	}
+	ready.set(checkListener)
+
+	// Behind a TCP load balancer the real visitor address arrives in a
+	// PROXY header; the raw listeners are kept for upgrades
+	served := listeners
+	if cfg.ProxyProtocol {
+		served = make([]net.Listener, len(listeners))
+		for i, ln := range listeners {
+			served[i] = newProxyListener(ln, cfg.trustedProxies)
+		}
+		slog.Info("Accepting PROXY protocol headers", "proxies", strings.Join(cfg.TrustedProxies, ","))
+	}
+
+	// Every listener shares the server, so they get the same handler chain
+	serveErr := make(chan error, len(served))
+	for _, ln := range served {
+		slog.Info("Starting SSH server", "addr", listenerName(ln))
+		go func(ln net.Listener) { serveErr <- srv.Serve(ln) }(ln)
+	}
+
+	notifyUpgradeReady()
+	sdNotify("READY=1")
+
+	// Docker stops containers with SIGTERM; drain sessions instead of dying
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	// SIGHUP/SIGUSR2 hand the listeners to a freshly started binary
+	upgradec := make(chan os.Signal, 1)
+	if len(upgradeSignals) > 0 {
+		signal.Notify(upgradec, upgradeSignals...)
+	}
+
+	upgraded := false
+	for !upgraded {
+		select {
+		case err := <-serveErr:
+			fatal("SSH server failed", "err", err)
+		case sig := <-sigc:
+			slog.Info("Shutting down", "signal", sig.String())
+			gracefulShutdown(srv, served, cfg.DrainPeriod, sigc)
+			stopWorkers()
+			analytics.close()
+			return
+		case sig := <-upgradec:
+			slog.Info("Upgrading", "signal", sig.String())
+			handoffs := make([]handoff, 0, len(listeners)+2)
+			for _, ln := range listeners {
+				handoffs = append(handoffs, handoff{listenerSSH, ln})
+			}
+			if healthLn != nil {
+				handoffs = append(handoffs, handoff{listenerHealth, healthLn})
+			}
+			if metricsLn != nil {
+				handoffs = append(handoffs, handoff{listenerMetrics, metricsLn})
+			}
+			if err := upgrade(handoffs); err != nil {
+				slog.Error("Upgrade failed, still serving", "err", err)
+				continue
+			}
+			upgraded = true
+		}
 	}
 
-	log.Printf("Starting SSH server on port %s...", port)     // Use determined port in log
-	log.Printf("Connect with: ssh <user>@<host> -p %s", port) // Use determined port in log
-	log.Fatal(srv.ListenAndServe())
+	// The new process delivers contact messages from here on
+	stopWorkers()
+	drainAfterUpgrade(sigc)
+	gracefulShutdown(srv, served, cfg.DrainPeriod, sigc)
 }
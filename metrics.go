@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	ssh "github.com/charmbracelet/ssh"
+	wish "github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/activeterm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// --- Prometheus Metrics ---
+
+var (
+	metricActiveSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "portfolio_active_sessions",
+		Help: "Number of SSH sessions currently open.",
+	})
+	metricConnections = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "portfolio_connections_total",
+		Help: "Total SSH sessions started.",
+	})
+	metricSessionDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "portfolio_session_duration_seconds",
+		Help:    "How long SSH sessions stay open.",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	})
+	metricTabSwitches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "portfolio_tab_switches_total",
+		Help: "Tab switches, by the section switched to.",
+	}, []string{"section"})
+	metricAuth = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "portfolio_auth_total",
+		Help: "Sessions established, by authentication method.",
+	}, []string{"method"})
+	metricPtyRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "portfolio_pty_rejections_total",
+		Help: "Sessions rejected because they did not request a PTY.",
+	})
+	metricRenderLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "portfolio_render_duration_seconds",
+		Help:    "Time spent rendering a frame in model.View.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 14), // 0.1ms to ~0.8s
+	})
+	metricRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "portfolio_rate_limited_total",
+		Help: "Sessions turned away by connection limits, by reason.",
+	}, []string{"reason"})
+	metricBlockedConns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "portfolio_blocked_connections_total",
+		Help: "Connections dropped before the handshake by the deny list or a ban.",
+	}, []string{"reason"})
+	metricAutoBans = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "portfolio_auto_bans_total",
+		Help: "Addresses banned automatically, by heuristic.",
+	}, []string{"kind"})
+	metricLoungeMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "portfolio_lounge_messages_total",
+		Help: "Lounge messages sent, by outcome.",
+	}, []string{"result"})
+	metricHostKeyErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "portfolio_host_key_errors_total",
+		Help: "Host key failures the server kept running through: unsigned proofs and retired keys left on disk.",
+	})
+)
+
+// metricsMiddleware counts sessions, how they authenticated and their
+// duration.
+func metricsMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			metricConnections.Inc()
+			metricAuth.WithLabelValues(authMethod(s)).Inc()
+			metricActiveSessions.Inc()
+			start := time.Now()
+			defer func() {
+				metricActiveSessions.Dec()
+				metricSessionDuration.Observe(time.Since(start).Seconds())
+			}()
+			next(s)
+		}
+	}
+}
+
+// authMethod names how s authenticated. Keyless clients fall back to
+// keyboard-interactive.
+func authMethod(s ssh.Session) string {
+	if s.PublicKey() != nil {
+		return "publickey"
+	}
+	return "keyboard-interactive"
+}
+
+// ptyMiddleware is activeterm's PTY check, counting the sessions it
+// rejects. Exec commands are served before it and are not counted.
+func ptyMiddleware() wish.Middleware {
+	check := activeterm.Middleware()
+	return func(next ssh.Handler) ssh.Handler {
+		checked := check(next)
+		return func(s ssh.Session) {
+			if _, _, ok := s.Pty(); !ok {
+				metricPtyRejections.Inc()
+			}
+			checked(s)
+		}
+	}
+}
+
+// observeRender records how long a View call took; use with defer.
+func observeRender(start time.Time) {
+	metricRenderLatency.Observe(time.Since(start).Seconds())
+}
+
+// serveMetrics exposes /metrics on ln until it is closed.
+func serveMetrics(ln net.Listener) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	slog.Info("Serving metrics", "url", "http://"+ln.Addr().String()+"/metrics")
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Error("Metrics server failed", "err", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	ssh "github.com/charmbracelet/ssh"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// keySession is a limitSession that authenticated with key.
+type keySession struct {
+	limitSession
+	key ssh.PublicKey
+}
+
+func (s *keySession) PublicKey() ssh.PublicKey { return s.key }
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestMetricsCountsAuthPerSession(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withKey := counterValue(t, metricAuth.WithLabelValues("publickey"))
+	keyless := counterValue(t, metricAuth.WithLabelValues("keyboard-interactive"))
+
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}
+	handler := metricsMiddleware()(func(ssh.Session) {})
+	handler(&keySession{limitSession: limitSession{addr: addr}, key: key})
+	handler(&keySession{limitSession: limitSession{addr: addr}})
+	handler(&keySession{limitSession: limitSession{addr: addr}})
+
+	if got := counterValue(t, metricAuth.WithLabelValues("publickey")) - withKey; got != 1 {
+		t.Errorf("counted %v publickey sessions, want 1", got)
+	}
+	if got := counterValue(t, metricAuth.WithLabelValues("keyboard-interactive")) - keyless; got != 2 {
+		t.Errorf("counted %v keyboard-interactive sessions, want 2", got)
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	deadLetterFile      = "dead-letter.jsonl"
+	maxDeliveryAttempts = 8
+	baseRetryDelay      = 30 * time.Second
+	maxRetryDelay       = time.Hour
+	// Messages waiting for delivery before new ones are turned away
+	maxQueuedMessages = 100
+)
+
+// contactMessage is one "send me a message" submission, stored as a JSON
+// file in cfg.OutboxDir until it is delivered or dead-lettered.
+type contactMessage struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Message     string    `json:"message"`
+	Sender      string    `json:"sender"` // Key fingerprint or IP of the session
+	Created     time.Time `json:"created"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+var (
+	errContactRateLimited = errors.New("you've sent a message recently, please try again later")
+	errContactBusy        = errors.New("there is a backlog of messages to deliver, please try again later")
+)
+
+// --- Delivery ---
+
+// messageSender delivers a contact message somewhere the owner will see it.
+type messageSender interface {
+	send(ctx context.Context, msg contactMessage) error
+	String() string
+}
+
+// smtpSender relays through a plain SMTP server, using STARTTLS and auth
+// when the server and settings allow it.
+type smtpSender struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       string
+}
+
+func (s smtpSender) String() string { return "smtp://" + s.addr }
+
+func (s smtpSender) send(ctx context.Context, msg contactMessage) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, _ := net.SplitHostPort(s.addr)
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", s.from)
+	fmt.Fprintf(&body, "To: %s\r\n", s.to)
+	fmt.Fprintf(&body, "Reply-To: %s\r\n", (&mail.Address{Name: msg.Name, Address: msg.Email}).String())
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Portfolio message from "+sanitizeHeader(msg.Name)))
+	fmt.Fprintf(&body, "Date: %s\r\n", msg.Created.Format(time.RFC1123Z))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Message, "\n", "\r\n"))
+	fmt.Fprintf(&body, "\r\n\r\n-- \r\nSent via SSH portfolio by %s\r\n", msg.Sender)
+
+	// net/smtp has no context support; run it aside so shutdown isn't blocked
+	errc := make(chan error, 1)
+	go func() { errc <- smtp.SendMail(s.addr, auth, s.from, []string{s.to}, body.Bytes()) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sanitizeHeader keeps user input from injecting extra mail headers.
+func sanitizeHeader(v string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(v)
+}
+
+// webhookSender POSTs the message as JSON.
+type webhookSender struct {
+	url    string
+	client *http.Client
+}
+
+// String names the webhook's host only, as its URL usually carries a token.
+func (w webhookSender) String() string {
+	u, err := url.Parse(w.url)
+	if err != nil {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func (w webhookSender) send(ctx context.Context, msg contactMessage) error {
+	payload, err := json.Marshal(map[string]any{
+		"name":    msg.Name,
+		"email":   msg.Email,
+		"message": msg.Message,
+		"sender":  msg.Sender,
+		"created": msg.Created,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// senderFromConfig picks the delivery method: the webhook wins over SMTP.
+// It returns nil when neither is configured, in which case messages just
+// stay queued on disk.
+func senderFromConfig(c config) messageSender {
+	if c.ContactWebhookURL != "" {
+		return webhookSender{url: c.ContactWebhookURL, client: &http.Client{Timeout: 15 * time.Second}}
+	}
+	if c.SMTPAddr != "" {
+		return smtpSender{
+			addr:     c.SMTPAddr,
+			username: c.SMTPUser,
+			password: c.SMTPPass,
+			from:     c.MailFrom,
+			to:       c.MailTo,
+		}
+	}
+	return nil
+}
+
+// --- Outbox ---
+
+// outbox queues contact messages on disk and delivers them in the background.
+type outbox struct {
+	dir    string
+	sender messageSender
+	wake   chan struct{}
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time // Rate limiting by sender
+	// Last message per IP, so the cooldown holds for visitors who switch keys
+	lastByIP map[string]time.Time
+}
+
+var contactOutbox = &outbox{
+	wake:     make(chan struct{}, 1),
+	lastSent: make(map[string]time.Time),
+	lastByIP: make(map[string]time.Time),
+}
+
+// enqueue checks the per-sender and per-IP rate limits and the queue size,
+// then writes msg to disk.
+func (o *outbox) enqueue(name, email, message string, info sessionInfo) error {
+	sender := info.Fingerprint
+	if sender == "" {
+		sender = "ip:" + hostOnly(info.RemoteAddr)
+	}
+	ip := hostOnly(info.RemoteAddr)
+
+	o.mu.Lock()
+	for _, m := range []map[string]time.Time{o.lastSent, o.lastByIP} {
+		for key, last := range m {
+			if time.Since(last) >= cfg.ContactCooldown {
+				delete(m, key) // Free to send again, no need to remember
+			}
+		}
+	}
+	_, sent := o.lastSent[sender]
+	_, sentFromIP := o.lastByIP[ip]
+	if sent || sentFromIP {
+		o.mu.Unlock()
+		return errContactRateLimited
+	}
+	queued, err := o.queued()
+	if err != nil {
+		o.mu.Unlock()
+		slog.Error("Failed to read outbox", "err", err)
+		return errors.New("could not queue your message, please try again later")
+	}
+	if queued >= maxQueuedMessages {
+		o.mu.Unlock()
+		slog.Warn("Outbox is full, turning a contact message away", "queued", queued, logKeyRemote, info.RemoteAddr)
+		return errContactBusy
+	}
+	if cfg.ContactCooldown > 0 {
+		o.lastSent[sender] = time.Now()
+		o.lastByIP[ip] = time.Now()
+	}
+	o.mu.Unlock()
+
+	msg := contactMessage{
+		ID:          time.Now().UTC().Format("20060102T150405") + "-" + newEntryID(),
+		Name:        name,
+		Email:       email,
+		Message:     message,
+		Sender:      sender,
+		Created:     time.Now(),
+		NextAttempt: time.Now(),
+	}
+	if err := o.write(msg); err != nil {
+		slog.Error("Failed to queue contact message", "err", err)
+		o.mu.Lock()
+		delete(o.lastSent, sender)
+		delete(o.lastByIP, ip)
+		o.mu.Unlock()
+		return errors.New("could not queue your message, please try again later")
+	}
+	slog.Info("Queued contact message", "message", msg.ID, logKeyRemote, info.RemoteAddr, "key", info.Fingerprint)
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (o *outbox) write(msg contactMessage) error {
+	if err := os.MkdirAll(o.dir, 0700); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(o.dir, msg.ID+".json"), raw, 0600)
+}
+
+// queued counts the messages waiting in the outbox.
+func (o *outbox) queued() (int, error) {
+	paths, err := filepath.Glob(filepath.Join(o.dir, "*.json"))
+	return len(paths), err
+}
+
+// pending reads every queued message, oldest first.
+func (o *outbox) pending() ([]contactMessage, error) {
+	paths, err := filepath.Glob(filepath.Join(o.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var out []contactMessage
+	for _, p := range paths {
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var msg contactMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			slog.Warn("Skipping unreadable outbox file", "path", p, "err", err)
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
+
+// run delivers due messages until ctx is cancelled.
+func (o *outbox) run(ctx context.Context) {
+	if o.sender == nil {
+		slog.Warn("No contact delivery configured; messages stay queued", "dir", o.dir)
+		return
+	}
+	slog.Info("Delivering contact messages", "via", fmt.Sprint(o.sender))
+
+	for {
+		next := o.deliverDue(ctx)
+		wait := time.Until(next)
+		if next.IsZero() || wait > maxRetryDelay {
+			wait = maxRetryDelay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// deliverDue attempts every message whose retry time has come and returns
+// when the next one is due (zero if the queue is empty).
+func (o *outbox) deliverDue(ctx context.Context) time.Time {
+	msgs, err := o.pending()
+	if err != nil {
+		slog.Error("Failed to read outbox", "err", err)
+		return time.Now().Add(baseRetryDelay)
+	}
+
+	var next time.Time
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			return next
+		}
+		if time.Now().Before(msg.NextAttempt) {
+			if next.IsZero() || msg.NextAttempt.Before(next) {
+				next = msg.NextAttempt
+			}
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := o.sender.send(sendCtx, msg)
+		cancel()
+		path := filepath.Join(o.dir, msg.ID+".json")
+		if err == nil {
+			slog.Info("Delivered contact message", "message", msg.ID)
+			if err := os.Remove(path); err != nil {
+				slog.Error("Failed to remove delivered message", "message", msg.ID, "err", err)
+			}
+			continue
+		}
+
+		msg.Attempts++
+		msg.LastError = err.Error()
+		if msg.Attempts >= maxDeliveryAttempts {
+			slog.Error("Giving up on contact message", "message", msg.ID, "attempts", msg.Attempts, "err", err)
+			if err := o.deadLetter(msg); err != nil {
+				slog.Error("Failed to dead-letter message", "message", msg.ID, "err", err)
+				continue
+			}
+			_ = os.Remove(path)
+			continue
+		}
+		msg.NextAttempt = time.Now().Add(retryDelay(msg.Attempts))
+		slog.Warn("Contact message delivery failed", "message", msg.ID, "attempt", msg.Attempts,
+			"retry_at", msg.NextAttempt.Format(time.RFC3339), "err", err)
+		if err := o.write(msg); err != nil {
+			slog.Error("Failed to update outbox message", "message", msg.ID, "err", err)
+		}
+		if next.IsZero() || msg.NextAttempt.Before(next) {
+			next = msg.NextAttempt
+		}
+	}
+	return next
+}
+
+// deadLetter appends msg to the dead-letter file as one JSON line.
+func (o *outbox) deadLetter(msg contactMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(o.dir, deadLetterFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// retryDelay is an exponential backoff: 30s, 1m, 2m, ... capped at an hour.
+func retryDelay(attempts int) time.Duration {
+	d := time.Duration(float64(baseRetryDelay) * math.Pow(2, float64(attempts-1)))
+	if d > maxRetryDelay || d <= 0 {
+		return maxRetryDelay
+	}
+	return d
+}
+
+// validEmail accepts a bare address like someone@example.com.
+func validEmail(v string) error {
+	addr, err := mail.ParseAddress(v)
+	if err != nil || addr.Address != v || !strings.Contains(v[strings.LastIndex(v, "@")+1:], ".") {
+		return errors.New("not a valid email address")
+	}
+	return nil
+}
+
+// --- Contact Form ---
+
+var contactFields = []fieldSpec{
+	{Label: "Name", Required: true, MaxLen: 60},
+	{Label: "Email", Required: true, MaxLen: 120, Check: validEmail},
+	{Label: "Message", Multi: true, Required: true, MaxLen: 2000, MaxLines: 20},
+}
+
+// contactModel is the "send me a message" form on the Contact tab.
+type contactModel struct {
+	form   *form
+	status string
+}
+
+func (c *contactModel) update(msg tea.Msg, sessionID string) tea.Cmd {
+	keyMsg, isKey := msg.(tea.KeyMsg)
+	if !isKey {
+		if c.form != nil {
+			return c.form.update(msg)
+		}
+		return nil
+	}
+
+	if c.form == nil {
+		if keyMsg.String() == "m" && cfg.EnableContactForm {
+			c.form = newForm("Send me a message", contactFields, nil)
+			c.status = ""
+		}
+		return nil
+	}
+
+	switch keyMsg.String() {
+	case "esc":
+		c.form = nil
+		return nil
+	case "ctrl+s":
+		if !c.form.validate() {
+			return nil
+		}
+		info, _ := hub.session(sessionID)
+		v := c.form.values()
+		if err := contactOutbox.enqueue(v[0], v[1], v[2], info); err != nil {
+			c.form.err = err.Error()
+			return nil
+		}
+		c.form = nil
+		c.status = "Thanks! Your message is on its way."
+		return nil
+	}
+	return c.form.update(msg)
+}
+
+func (c *contactModel) help() string {
+	if c.form != nil {
+		return "tab: next field • ctrl+s: send • esc: cancel"
+	}
+	if !cfg.EnableContactForm {
+		return "←/→ or h/l: switch • q: quit"
+	}
+	return "←/→ or h/l: switch • m: message me • q: quit"
+}
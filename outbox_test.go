@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testContactMessage() contactMessage {
+	return contactMessage{
+		ID:      "20260102T030405-abc",
+		Name:    "Zoë Example",
+		Email:   "zoe@example.com",
+		Message: "Hello!\nSecond line",
+		Sender:  "SHA256:test",
+		Created: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+// fakeSMTP is a minimal SMTP server that accepts one message and hands its
+// DATA to the returned channel.
+func fakeSMTP(t *testing.T) (addr string, data <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var b strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					b.WriteString(l)
+				}
+				out <- b.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func TestSMTPSender(t *testing.T) {
+	addr, data := fakeSMTP(t)
+	s := smtpSender{addr: addr, from: "portfolio@example.com", to: "owner@example.com"}
+	msg := testContactMessage()
+	if err := s.send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var raw string
+	select {
+	case raw = <-data:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	m, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Header.Get("To"); got != "owner@example.com" {
+		t.Errorf("got To %q", got)
+	}
+	subject := m.Header.Get("Subject")
+	if strings.Contains(subject, "ë") {
+		t.Errorf("subject %q is not encoded", subject)
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(subject)
+	if err != nil || decoded != "Portfolio message from Zoë Example" {
+		t.Errorf("got subject %q (%v)", decoded, err)
+	}
+	reply, err := mail.ParseAddress(m.Header.Get("Reply-To"))
+	if err != nil || reply.Address != "zoe@example.com" || reply.Name != "Zoë Example" {
+		t.Errorf("got Reply-To %v (%v)", reply, err)
+	}
+	body, _ := io.ReadAll(m.Body)
+	if !strings.Contains(string(body), "Hello!\r\nSecond line") {
+		t.Errorf("got body %q", body)
+	}
+}
+
+func TestSMTPSenderHeaderInjection(t *testing.T) {
+	addr, data := fakeSMTP(t)
+	s := smtpSender{addr: addr, from: "portfolio@example.com", to: "owner@example.com"}
+	msg := testContactMessage()
+	msg.Name = "Eve\r\nBcc: victim@example.com"
+	if err := s.send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mail.ReadMessage(strings.NewReader(<-data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Header.Get("Bcc"); got != "" {
+		t.Errorf("injected Bcc header %q", got)
+	}
+}
+
+func TestWebhookSender(t *testing.T) {
+	var got map[string]any
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	w := webhookSender{url: srv.URL, client: srv.Client()}
+	if err := w.send(context.Background(), testContactMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if got["name"] != "Zoë Example" || got["email"] != "zoe@example.com" || got["sender"] != "SHA256:test" {
+		t.Errorf("got payload %v", got)
+	}
+
+	status = http.StatusBadGateway
+	if err := w.send(context.Background(), testContactMessage()); err == nil {
+		t.Error("want an error for a 502 response")
+	}
+}
+
+func TestOutboxDelivery(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	o := &outbox{dir: t.TempDir(), sender: webhookSender{url: srv.URL, client: srv.Client()}}
+	msg := testContactMessage()
+	msg.NextAttempt = time.Now()
+	if err := o.write(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first attempt fails and is rescheduled with backoff
+	next := o.deliverDue(context.Background())
+	pending, err := o.pending()
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("got %d pending (%v), want 1", len(pending), err)
+	}
+	if pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Errorf("got attempts %d, error %q", pending[0].Attempts, pending[0].LastError)
+	}
+	if wait := time.Until(next); wait <= 0 || wait > baseRetryDelay {
+		t.Errorf("next attempt in %v, want within %v", wait, baseRetryDelay)
+	}
+
+	// Once due again it is delivered and removed
+	pending[0].NextAttempt = time.Now()
+	if err := o.write(pending[0]); err != nil {
+		t.Fatal(err)
+	}
+	o.deliverDue(context.Background())
+	if pending, _ := o.pending(); len(pending) != 0 {
+		t.Errorf("got %d pending after delivery, want 0", len(pending))
+	}
+}
+
+func TestOutboxDeadLetter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer srv.Close()
+
+	o := &outbox{dir: t.TempDir(), sender: webhookSender{url: srv.URL, client: srv.Client()}}
+	msg := testContactMessage()
+	msg.Attempts = maxDeliveryAttempts - 1
+	if err := o.write(msg); err != nil {
+		t.Fatal(err)
+	}
+	o.deliverDue(context.Background())
+	if pending, _ := o.pending(); len(pending) != 0 {
+		t.Errorf("got %d pending, want the message dead-lettered", len(pending))
+	}
+	raw, err := os.ReadFile(filepath.Join(o.dir, deadLetterFile))
+	if err != nil || !strings.Contains(string(raw), msg.ID) {
+		t.Errorf("dead letter file: %q (%v)", raw, err)
+	}
+}
+
+func TestOutboxCooldown(t *testing.T) {
+	setTestConfig(t, config{ContactCooldown: time.Minute})
+	o := testOutbox(t)
+	info := sessionInfo{Fingerprint: "SHA256:a", RemoteAddr: "192.0.2.1:1234"}
+	if err := o.enqueue("A", "a@example.com", "hi", info); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.enqueue("A", "a@example.com", "again", info); err != errContactRateLimited {
+		t.Errorf("got %v, want errContactRateLimited", err)
+	}
+
+	// Senders whose cooldown has passed are forgotten
+	for i := range 50 {
+		o.lastSent["stale"+string(rune('a'+i))] = time.Now().Add(-2 * time.Minute)
+	}
+	if err := o.enqueue("B", "b@example.com", "hi", sessionInfo{RemoteAddr: "192.0.2.2:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.lastSent) != 2 || len(o.lastByIP) != 2 {
+		t.Errorf("got %d remembered senders and %d IPs, want 2 each", len(o.lastSent), len(o.lastByIP))
+	}
+
+	// A new key from the same address is still cooling down
+	other := sessionInfo{Fingerprint: "SHA256:b", RemoteAddr: "192.0.2.1:5678"}
+	if err := o.enqueue("A", "a@example.com", "new key", other); err != errContactRateLimited {
+		t.Errorf("got %v for a new key from the same IP, want errContactRateLimited", err)
+	}
+}
+
+func testOutbox(t *testing.T) *outbox {
+	return &outbox{
+		dir:      t.TempDir(),
+		wake:     make(chan struct{}, 1),
+		lastSent: make(map[string]time.Time),
+		lastByIP: make(map[string]time.Time),
+	}
+}
+
+func TestOutboxFull(t *testing.T) {
+	setTestConfig(t, config{})
+	o := testOutbox(t)
+	for i := range maxQueuedMessages {
+		info := sessionInfo{RemoteAddr: fmt.Sprintf("192.0.2.%d:1", i)}
+		if err := o.enqueue("A", "a@example.com", "hi", info); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	extra := sessionInfo{RemoteAddr: "198.51.100.1:1"}
+	if err := o.enqueue("A", "a@example.com", "hi", extra); err != errContactBusy {
+		t.Fatalf("got %v, want errContactBusy", err)
+	}
+
+	// Delivering one makes room
+	msgs, err := o.pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(o.dir, msgs[0].ID+".json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.enqueue("A", "a@example.com", "hi", extra); err != nil {
+		t.Errorf("after one was delivered: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var stylePresence = lipgloss.NewStyle().Foreground(helpColor).PaddingTop(1)
+
+// --- Presence ---
+
+// presenceMsg is pushed to every session whenever someone joins, leaves or
+// switches tabs. Tabs is only filled in for admins.
+type presenceMsg struct {
+	Viewers int
+	Tabs    []tabCount
+}
+
+// tabCount is how many visitor sessions are on a tab.
+type tabCount struct {
+	Tab      string
+	Sessions int
+}
+
+// visitorKey identifies a person across sessions: their key, or their host
+// for keyless logins.
+func visitorKey(info *sessionInfo) string {
+	if info.Fingerprint != "" {
+		return info.Fingerprint
+	}
+	return hostOnly(info.RemoteAddr)
+}
+
+// presence counts the people connected and the visitor sessions on each
+// tab, busiest first. Admins count as viewers but not towards tabs.
+func (h *sessionHub) presence() presenceMsg {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.presenceLocked()
+}
+
+func (h *sessionHub) presenceLocked() presenceMsg {
+	people := make(map[string]struct{})
+	perTab := make(map[string]int)
+	for _, info := range h.sessions {
+		people[visitorKey(info)] = struct{}{}
+		if !info.Admin && info.Tab != "" {
+			perTab[info.Tab]++
+		}
+	}
+
+	msg := presenceMsg{Viewers: len(people)}
+	for tab, n := range perTab {
+		msg.Tabs = append(msg.Tabs, tabCount{Tab: tab, Sessions: n})
+	}
+	sort.Slice(msg.Tabs, func(i, j int) bool {
+		if msg.Tabs[i].Sessions != msg.Tabs[j].Sessions {
+			return msg.Tabs[i].Sessions > msg.Tabs[j].Sessions
+		}
+		return msg.Tabs[i].Tab < msg.Tabs[j].Tab
+	})
+	return msg
+}
+
+// pushPresenceLocked queues the current presence for every session, with
+// the per-tab breakdown for admins only. Computing and queuing under the
+// same lock keeps a later snapshot from overtaking an earlier one.
+func (h *sessionHub) pushPresenceLocked() {
+	full := h.presenceLocked()
+	h.sendLocked(presenceMsg{Viewers: full.Viewers}, func(info *sessionInfo) bool { return !info.Admin })
+	h.sendLocked(full, func(info *sessionInfo) bool { return info.Admin })
+}
+
+// presenceView is the "N people viewing" note at the right of the header,
+// cut to width. Admins also see which tabs visitors are on.
+func (m *model) presenceView(width int) string {
+	if m.presence.Viewers == 0 || width < 1 {
+		return ""
+	}
+	text := fmt.Sprintf("%d people viewing", m.presence.Viewers)
+	if m.presence.Viewers == 1 {
+		text = "1 person viewing"
+	}
+	if m.admin {
+		for _, t := range m.presence.Tabs {
+			text += fmt.Sprintf(" · %s %d", t.Tab, t.Sessions)
+		}
+	}
+	return stylePresence.Render(ansi.Truncate(text, width, "…"))
+}
+
+// headerView is the title with the presence note right-aligned beside it.
+func (m *model) headerView() string {
+	header := styleHeaderText.Render("Liem Luttrell - SSH Portfolio")
+	room := m.w - lipgloss.Width(header) - 3 // At least two spaces before, one after
+	presence := m.presenceView(room)
+	if presence == "" {
+		return header
+	}
+	gap := strings.Repeat(" ", m.w-lipgloss.Width(header)-lipgloss.Width(presence)-1)
+	return lipgloss.JoinHorizontal(lipgloss.Top, header, gap, presence)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	proxyHeaderTimeout = 5 * time.Second
+	proxyV1MaxLen      = 107 // Longest valid v1 line, CRLF included
+	// Addresses plus TLVs; real proxies send well under this
+	proxyV2MaxLen = 4096
+	// Backoff after a failed Accept, e.g. when out of file descriptors
+	acceptBackoffMin = 5 * time.Millisecond
+	acceptBackoffMax = time.Second
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// --- PROXY Protocol ---
+
+// proxyListener strips the PROXY protocol header (v1 or v2) that a trusted
+// load balancer puts in front of each connection, so RemoteAddr reports
+// the visitor rather than the proxy. Headers are read off the accept path,
+// one goroutine per connection, so a slow peer cannot stall Accept.
+// Connections from untrusted peers are passed through untouched; Unix
+// socket peers are local and always trusted.
+type proxyListener struct {
+	net.Listener
+	trusted []*net.IPNet
+
+	conns chan net.Conn
+	errc  chan error
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newProxyListener(ln net.Listener, trusted []*net.IPNet) *proxyListener {
+	l := &proxyListener{
+		Listener: ln,
+		trusted:  trusted,
+		conns:    make(chan net.Conn),
+		errc:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+// acceptLoop accepts until the listener is closed. Other errors, such as
+// running out of file descriptors, are retried with a growing delay rather
+// than handed to the server, which would stop serving.
+func (l *proxyListener) acceptLoop() {
+	var delay time.Duration
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				select {
+				case l.errc <- err:
+				case <-l.done:
+				}
+				return
+			}
+			delay = min(max(delay*2, acceptBackoffMin), acceptBackoffMax)
+			slog.Warn("Failed to accept connection, retrying", "err", err, "delay", delay)
+			select {
+			case <-time.After(delay):
+			case <-l.done:
+				return
+			}
+			continue
+		}
+		delay = 0
+		go l.handshake(conn)
+	}
+}
+
+func (l *proxyListener) handshake(conn net.Conn) {
+	if !l.trustedPeer(conn.RemoteAddr()) {
+		l.deliver(conn)
+		return
+	}
+	r := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	addr, err := readProxyHeader(r)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		slog.Warn("Dropping connection from proxy", logKeyRemote, conn.RemoteAddr().String(), "err", err)
+		conn.Close()
+		return
+	}
+	pc := &proxyConn{Conn: conn, r: r, remote: addr}
+	if addr == nil {
+		pc.remote = conn.RemoteAddr() // LOCAL or UNKNOWN, e.g. health checks
+	}
+	l.deliver(pc)
+}
+
+func (l *proxyListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *proxyListener) trustedPeer(addr net.Addr) bool {
+	if _, ok := addr.(*net.UnixAddr); ok {
+		return true
+	}
+	ip := net.ParseIP(hostOnly(addr.String()))
+	return ip != nil && ipInNets(ip, l.trusted)
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errc:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *proxyListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// proxyConn reads through the buffer the header was parsed from and
+// reports the address the proxy gave us.
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+func (c *proxyConn) RemoteAddr() net.Addr       { return c.remote }
+
+// readProxyHeader parses a v1 or v2 header. It returns a nil address for
+// connections the proxy made itself (v1 UNKNOWN, v2 LOCAL) and for address
+// families other than TCP over IPv4/IPv6.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY header: %w", err)
+	}
+	switch first[0] {
+	case 'P':
+		return readProxyV1(r)
+	case '\r':
+		return readProxyV2(r)
+	}
+	return nil, errors.New("missing PROXY protocol header")
+}
+
+// readProxyV1 parses "PROXY TCP4 <src> <dst> <sport> <dport>\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PROXY v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLen {
+			return nil, errors.New("PROXY v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY v1 header not terminated by CRLF")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, errors.New("invalid PROXY v1 header")
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY v1 header %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("invalid PROXY v1 source %s:%s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 parses the binary header: signature, version/command,
+// family, length and then the addresses followed by optional TLVs.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 header: %w", err)
+	}
+	if !bytes.Equal(hdr[:12], proxyV2Signature) {
+		return nil, errors.New("invalid PROXY v2 signature")
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", hdr[12]>>4)
+	}
+	length := binary.BigEndian.Uint16(hdr[14:16])
+	if length > proxyV2MaxLen {
+		return nil, fmt.Errorf("PROXY v2 header too long (%d bytes)", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 addresses: %w", err)
+	}
+
+	switch hdr[12] & 0x0f {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v2 command %d", hdr[12]&0x0f)
+	}
+	switch hdr[13] {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("short PROXY v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("short PROXY v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	return nil, nil
+}
+
+// parseCIDRs parses a list of CIDRs; bare IPs are taken as single hosts.
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// proxyV2 builds a v2 header with the given version/command byte, family
+// and address block.
+func proxyV2(verCmd, family byte, payload []byte) []byte {
+	var b bytes.Buffer
+	b.Write(proxyV2Signature)
+	b.WriteByte(verCmd)
+	b.WriteByte(family)
+	binary.Write(&b, binary.BigEndian, uint16(len(payload)))
+	b.Write(payload)
+	return b.Bytes()
+}
+
+func ipv4Block(src, dst string, sport, dport uint16) []byte {
+	b := append(net.ParseIP(src).To4(), net.ParseIP(dst).To4()...)
+	b = binary.BigEndian.AppendUint16(b, sport)
+	return binary.BigEndian.AppendUint16(b, dport)
+}
+
+func ipv6Block(src, dst string, sport, dport uint16) []byte {
+	b := append(net.ParseIP(src).To16(), net.ParseIP(dst).To16()...)
+	b = binary.BigEndian.AppendUint16(b, sport)
+	return binary.BigEndian.AppendUint16(b, dport)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tooLong := proxyV2(0x21, 0x11, nil)
+	binary.BigEndian.PutUint16(tooLong[14:16], proxyV2MaxLen+1)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		want    string // "" for a nil address
+		wantErr bool
+	}{
+		{name: "v1 tcp4", input: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 22\r\nSSH-2.0"), want: "203.0.113.7:51234"},
+		{name: "v1 tcp6", input: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 4000 22\r\n"), want: "[2001:db8::1]:4000"},
+		{name: "v1 unknown", input: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 unknown with addresses", input: []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n")},
+		{name: "v1 truncated", input: []byte("PROXY TCP4 203.0.113.7"), wantErr: true},
+		{name: "v1 missing CR", input: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 22\n"), wantErr: true},
+		{name: "v1 too long", input: []byte("PROXY TCP4 " + strings.Repeat("1", proxyV1MaxLen) + "\r\n"), wantErr: true},
+		{name: "v1 bad family", input: []byte("PROXY UDP4 203.0.113.7 10.0.0.1 51234 22\r\n"), wantErr: true},
+		{name: "v1 bad address", input: []byte("PROXY TCP4 not-an-ip 10.0.0.1 51234 22\r\n"), wantErr: true},
+		{name: "v1 bad port", input: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 99999 22\r\n"), wantErr: true},
+		{name: "v1 missing fields", input: []byte("PROXY TCP4 203.0.113.7\r\n"), wantErr: true},
+		{name: "v2 tcp4", input: proxyV2(0x21, 0x11, ipv4Block("198.51.100.9", "10.0.0.1", 40000, 22)), want: "198.51.100.9:40000"},
+		{name: "v2 tcp6", input: proxyV2(0x21, 0x21, ipv6Block("2001:db8::9", "2001:db8::1", 40001, 22)), want: "[2001:db8::9]:40001"},
+		{name: "v2 tcp4 with TLVs", input: proxyV2(0x21, 0x11, append(ipv4Block("198.51.100.9", "10.0.0.1", 1, 22), 0x04, 0, 1, 'x')), want: "198.51.100.9:1"},
+		{name: "v2 local", input: proxyV2(0x20, 0x00, nil)},
+		{name: "v2 unix family", input: proxyV2(0x21, 0x31, make([]byte, 216))},
+		{name: "v2 unknown command", input: proxyV2(0x22, 0x11, ipv4Block("198.51.100.9", "10.0.0.1", 1, 22)), wantErr: true},
+		{name: "v2 wrong version", input: proxyV2(0x11, 0x11, ipv4Block("198.51.100.9", "10.0.0.1", 1, 22)), wantErr: true},
+		{name: "v2 bad signature", input: append([]byte("\r\n\r\nXXXXXXXX"), 0x21, 0x11, 0, 0), wantErr: true},
+		{name: "v2 truncated header", input: proxyV2Signature[:8], wantErr: true},
+		{name: "v2 truncated addresses", input: proxyV2(0x21, 0x11, ipv4Block("198.51.100.9", "10.0.0.1", 1, 22))[:20], wantErr: true},
+		{name: "v2 short ipv4 block", input: proxyV2(0x21, 0x11, make([]byte, 8)), wantErr: true},
+		{name: "v2 short ipv6 block", input: proxyV2(0x21, 0x21, make([]byte, 12)), wantErr: true},
+		{name: "v2 oversized length", input: tooLong, wantErr: true},
+		{name: "no header", input: []byte("SSH-2.0-OpenSSH_9.6\r\n"), wantErr: true},
+		{name: "empty", input: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := readProxyHeader(bufio.NewReader(bytes.NewReader(tt.input)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("got address %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderLeavesPayload(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 203.0.113.7 10.0.0.1 51234 22\r\nSSH-2.0-test\r\n"))
+	if _, err := readProxyHeader(r); err != nil {
+		t.Fatal(err)
+	}
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "SSH-2.0-test\r\n" {
+		t.Errorf("got remaining %q", rest)
+	}
+}
+
+// dialThrough sends data to l and returns the connection it accepted.
+func dialThrough(t *testing.T, l net.Listener, data string) net.Conn {
+	t.Helper()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, err := client.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestProxyListenerTrust(t *testing.T) {
+	const header = "PROXY TCP4 203.0.113.7 10.0.0.1 51234 22\r\n"
+	loopback, _ := parseCIDRs([]string{"127.0.0.0/8"})
+	other, _ := parseCIDRs([]string{"192.0.2.0/24"})
+
+	tests := []struct {
+		name       string
+		trusted    []*net.IPNet
+		wantRemote string // "" means the real peer address
+		wantData   string
+	}{
+		{name: "trusted peer", trusted: loopback, wantRemote: "203.0.113.7:51234", wantData: "hello"},
+		{name: "untrusted peer", trusted: other, wantData: header + "hello"},
+		{name: "no trusted proxies", trusted: nil, wantData: header + "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := newProxyListener(ln, tt.trusted)
+			defer l.Close()
+
+			conn := dialThrough(t, l, header+"hello")
+			if tt.wantRemote != "" && conn.RemoteAddr().String() != tt.wantRemote {
+				t.Errorf("got remote %s, want %s", conn.RemoteAddr(), tt.wantRemote)
+			}
+			if tt.wantRemote == "" && !strings.HasPrefix(conn.RemoteAddr().String(), "127.0.0.1:") {
+				t.Errorf("got remote %s, want the loopback peer", conn.RemoteAddr())
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			buf := make([]byte, len(tt.wantData))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != tt.wantData {
+				t.Errorf("got data %q, want %q", buf, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestProxyListenerDropsBadHeader(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loopback, _ := parseCIDRs([]string{"127.0.0.1"})
+	l := newProxyListener(ln, loopback)
+	defer l.Close()
+
+	bad, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+	bad.Write([]byte("SSH-2.0-sneaky\r\n"))
+
+	// The next, well-formed connection is the one delivered
+	conn := dialThrough(t, l, "PROXY TCP4 203.0.113.8 10.0.0.1 1000 22\r\n")
+	if got := conn.RemoteAddr().String(); got != "203.0.113.8:1000" {
+		t.Errorf("got remote %s", got)
+	}
+	// And the bad one was closed
+	_ = bad.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := bad.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("got %v, want EOF on the dropped connection", err)
+	}
+}
+
+// flakyListener fails a few Accepts with a transient error first.
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+	return l.Listener.Accept()
+}
+
+func TestProxyListenerSurvivesTransientErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newProxyListener(&flakyListener{Listener: ln, failures: 3}, nil)
+	defer l.Close()
+
+	conn := dialThrough(t, l, "hi")
+	if conn == nil {
+		t.Fatal("no connection after transient errors")
+	}
+}
+
+func TestProxyListenerClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newProxyListener(ln, nil)
+	l.Close()
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("got %v, want net.ErrClosed", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	ssh "github.com/charmbracelet/ssh"
+	wish "github.com/charmbracelet/wish"
+)
+
+const limiterSweepTick = 5 * time.Minute
+
+// Reasons a session is turned away, used as the metric label
+const (
+	limitRate   = "rate"
+	limitPerIP  = "per_ip"
+	limitGlobal = "global"
+)
+
+var limitMessages = map[string]string{
+	limitRate:   "Whoa, slow down! Too many connections from your address. Please try again in a minute.",
+	limitPerIP:  "You already have the maximum number of sessions open from this address. Close one and try again.",
+	limitGlobal: "The server is at capacity right now. Please try again shortly.",
+}
+
+// --- Connection Limits ---
+
+// bucket is a token bucket refilled continuously at the limiter's rate.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// connLimiter enforces a per-IP token bucket for new sessions, a cap on
+// concurrent sessions per IP and a global cap. Zero disables a limit.
+type connLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // Tokens per second
+	burst   float64
+	perIP   int
+	global  int
+	buckets map[string]*bucket
+	active  map[string]int
+	total   int
+	now     func() time.Time // Replaced in tests
+}
+
+var limits = newConnLimiter()
+
+func newConnLimiter() *connLimiter {
+	return &connLimiter{buckets: make(map[string]*bucket), active: make(map[string]int), now: time.Now}
+}
+
+// configure applies the limits from cfg.
+func (l *connLimiter) configure(c config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(c.RateLimitPerMinute) / 60
+	l.burst = float64(c.RateLimitBurst)
+	l.perIP = c.MaxSessionsPerIP
+	l.global = c.MaxSessions
+}
+
+// admit reserves a session slot for ip, returning the reason it was
+// refused or "" on success. Admitted sessions must be released.
+func (l *connLimiter) admit(ip string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.global > 0 && l.total >= l.global {
+		return limitGlobal
+	}
+	if l.perIP > 0 && l.active[ip] >= l.perIP {
+		return limitPerIP
+	}
+	if l.rate > 0 {
+		now := l.now()
+		b, ok := l.buckets[ip]
+		if !ok {
+			b = &bucket{tokens: l.burst, last: now}
+			l.buckets[ip] = b
+		}
+		b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+		if b.tokens < 1 {
+			return limitRate
+		}
+		b.tokens--
+	}
+	l.active[ip]++
+	l.total++
+	return ""
+}
+
+func (l *connLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.active[ip] <= 1 {
+		delete(l.active, ip)
+		return
+	}
+	l.active[ip]--
+}
+
+// sweep forgets buckets that have refilled, so memory tracks recent
+// visitors rather than every address ever seen.
+func (l *connLimiter) sweep() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for ip, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+func (l *connLimiter) runSweeper() {
+	for {
+		time.Sleep(limiterSweepTick)
+		l.sweep()
+	}
+}
+
+// rateLimitMiddleware turns away sessions over the limits with a short
+// explanation on stderr. It runs before metricsMiddleware, so rejected
+// sessions only show up in portfolio_rate_limited_total.
+func rateLimitMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			ip := hostOnly(s.RemoteAddr().String())
+			if reason := limits.admit(ip); reason != "" {
+				metricRateLimited.WithLabelValues(reason).Inc()
+				wish.Errorln(s, limitMessages[reason])
+				_ = s.Exit(1)
+				return
+			}
+			defer limits.release(ip)
+			next(s)
+		}
+	}
+}
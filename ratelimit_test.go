@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ssh "github.com/charmbracelet/ssh"
+)
+
+// fakeClock is a settable time source for connLimiter.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// testLimiter returns a limiter with the given limits driven by a fake clock.
+func testLimiter(perMinute, burst, perIP, global int) (*connLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	l := newConnLimiter()
+	l.now = clock.now
+	l.configure(config{RateLimitPerMinute: perMinute, RateLimitBurst: burst, MaxSessionsPerIP: perIP, MaxSessions: global})
+	return l, clock
+}
+
+// admitReleased admits a session for ip and ends it straight away.
+func admitReleased(l *connLimiter, ip string) string {
+	reason := l.admit(ip)
+	if reason == "" {
+		l.release(ip)
+	}
+	return reason
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	l, clock := testLimiter(6, 3, 0, 0) // One token every 10s
+	for i := range 3 {
+		if got := admitReleased(l, "192.0.2.1"); got != "" {
+			t.Fatalf("session %d of the burst refused: %s", i+1, got)
+		}
+	}
+	if got := admitReleased(l, "192.0.2.1"); got != limitRate {
+		t.Fatalf("got %q past the burst, want %q", got, limitRate)
+	}
+	if got := admitReleased(l, "192.0.2.2"); got != "" {
+		t.Errorf("another IP was refused: %s", got)
+	}
+
+	clock.advance(9 * time.Second)
+	if got := admitReleased(l, "192.0.2.1"); got != limitRate {
+		t.Errorf("got %q before a whole token refilled", got)
+	}
+	clock.advance(time.Second)
+	if got := admitReleased(l, "192.0.2.1"); got != "" {
+		t.Errorf("got %q after one token refilled", got)
+	}
+	if got := admitReleased(l, "192.0.2.1"); got != limitRate {
+		t.Errorf("got %q, want the refilled token used up", got)
+	}
+
+	// Refill stops at the burst size
+	clock.advance(time.Hour)
+	for i := range 3 {
+		if got := admitReleased(l, "192.0.2.1"); got != "" {
+			t.Fatalf("session %d after an idle hour refused: %s", i+1, got)
+		}
+	}
+	if got := admitReleased(l, "192.0.2.1"); got != limitRate {
+		t.Errorf("got %q, want the bucket capped at the burst", got)
+	}
+}
+
+func TestLimiterRateDisabled(t *testing.T) {
+	l, _ := testLimiter(0, 0, 0, 0)
+	for range 100 {
+		if got := admitReleased(l, "192.0.2.1"); got != "" {
+			t.Fatalf("got %q with no limits", got)
+		}
+	}
+	if len(l.buckets) != 0 {
+		t.Errorf("got %d buckets with the rate limit off", len(l.buckets))
+	}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	l, _ := testLimiter(0, 0, 2, 3)
+	for range 2 {
+		if got := l.admit("192.0.2.1"); got != "" {
+			t.Fatal(got)
+		}
+	}
+	if got := l.admit("192.0.2.1"); got != limitPerIP {
+		t.Errorf("got %q for a third session, want %q", got, limitPerIP)
+	}
+	if got := l.admit("192.0.2.2"); got != "" {
+		t.Fatal(got)
+	}
+	if got := l.admit("192.0.2.3"); got != limitGlobal {
+		t.Errorf("got %q past the global cap, want %q", got, limitGlobal)
+	}
+
+	l.release("192.0.2.1")
+	if got := l.admit("192.0.2.1"); got != "" {
+		t.Errorf("got %q after a session ended", got)
+	}
+	l.release("192.0.2.1")
+	l.release("192.0.2.1")
+	l.release("192.0.2.2")
+	if l.total != 0 || len(l.active) != 0 {
+		t.Errorf("got total %d, active %v after every session ended", l.total, l.active)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l, clock := testLimiter(6, 3, 0, 0)
+	admitReleased(l, "192.0.2.1")
+	admitReleased(l, "192.0.2.1")
+	clock.advance(10 * time.Second)
+	admitReleased(l, "192.0.2.2")
+	admitReleased(l, "192.0.2.2")
+
+	clock.advance(10 * time.Second)
+	l.sweep()
+	if _, ok := l.buckets["192.0.2.1"]; ok {
+		t.Error("kept a bucket that has refilled")
+	}
+	if _, ok := l.buckets["192.0.2.2"]; !ok {
+		t.Error("dropped a bucket that is still refilling")
+	}
+}
+
+// limitSession is just enough of an ssh.Session for rateLimitMiddleware.
+type limitSession struct {
+	ssh.Session
+	addr   net.Addr
+	stderr bytes.Buffer
+	exit   int
+}
+
+func (s *limitSession) RemoteAddr() net.Addr        { return s.addr }
+func (s *limitSession) Stderr() io.ReadWriter       { return &s.stderr }
+func (s *limitSession) Exit(code int) error         { s.exit = code; return nil }
+func (s *limitSession) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestRateLimitMiddlewareReleases(t *testing.T) {
+	saved := limits
+	t.Cleanup(func() { limits = saved })
+	limits, _ = testLimiter(0, 0, 1, 0)
+
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}
+	var ran int
+	handler := rateLimitMiddleware()(func(ssh.Session) { ran++ })
+	for i := range 3 {
+		// Each session ends before the next, so the one slot is reused
+		s := &limitSession{addr: addr}
+		handler(s)
+		if ran != i+1 || s.exit != 0 {
+			t.Fatalf("session %d: ran %d, exit %d", i+1, ran, s.exit)
+		}
+	}
+
+	// While one is open, another from the same IP is turned away
+	blocked := &limitSession{addr: addr}
+	rateLimitMiddleware()(func(ssh.Session) { handler(blocked) })(&limitSession{addr: addr})
+	if blocked.exit != 1 || !strings.Contains(blocked.stderr.String(), "maximum number of sessions") {
+		t.Errorf("got exit %d, stderr %q", blocked.exit, blocked.stderr.String())
+	}
+	if limits.total != 0 || len(limits.active) != 0 {
+		t.Errorf("got total %d, active %v after the sessions ended", limits.total, limits.active)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ssh "github.com/charmbracelet/ssh"
+)
+
+const (
+	recordingExt       = ".cast"
+	recordingPruneTick = time.Hour
+	// Pauses longer than this are shortened on replay, like asciinema's
+	// idle_time_limit
+	replayIdleLimit = 2 * time.Second
+	// Shown in place of the screen while a form is open
+	recordingPausedNotice = "\x1b[2J\x1b[H[Form input is not recorded]"
+)
+
+var errRecordingNotFound = errors.New("recording not found")
+
+// --- Session Recordings ---
+
+// castHeader is the first line of an asciicast v2 file.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// castEvent is one output ("o") or resize ("r") event, at Time seconds
+// since the start.
+type castEvent struct {
+	Time float64
+	Kind string
+	Data string
+}
+
+func (e castEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{e.Time, e.Kind, e.Data})
+}
+
+func (e *castEvent) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return fmt.Errorf("event has %d fields, want 3", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw[1], &e.Kind); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw[2], &e.Data)
+}
+
+// recorder appends one session's output and resizes to its cast file until
+// the size limit is reached. Output is left out while it is paused.
+type recorder struct {
+	mu      sync.Mutex
+	f       *os.File
+	start   time.Time
+	written int64
+	full    bool
+	paused  bool
+}
+
+func (r *recorder) event(kind, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused && kind == "o" {
+		return
+	}
+	r.writeLocked(kind, data)
+}
+
+// setPaused pauses or resumes recording output and reports whether that
+// changed anything. Pausing records a notice in place of the screen.
+func (r *recorder) setPaused(paused bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused == paused {
+		return false
+	}
+	r.paused = paused
+	if paused {
+		r.writeLocked("o", recordingPausedNotice)
+	}
+	return true
+}
+
+func (r *recorder) writeLocked(kind, data string) {
+	if r.f == nil || r.full {
+		return
+	}
+	line, err := json.Marshal(castEvent{Time: time.Since(r.start).Seconds(), Kind: kind, Data: data})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	if cfg.RecordingMaxBytes > 0 && r.written+int64(len(line)) > int64(cfg.RecordingMaxBytes) {
+		r.full = true // Keep what we have; a truncated cast still replays
+		return
+	}
+	n, err := r.f.Write(line)
+	r.written += int64(n)
+	if err != nil {
+		slog.Error("Failed to write recording", "path", r.f.Name(), "err", err)
+		r.full = true
+	}
+}
+
+func (r *recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return
+	}
+	if err := r.f.Close(); err != nil {
+		slog.Error("Failed to close recording", "path", r.f.Name(), "err", err)
+	}
+	r.f = nil
+}
+
+// recordedOutput tees a program's output into its recorder.
+type recordedOutput struct {
+	io.Writer
+	rec *recorder
+}
+
+func (o recordedOutput) Write(p []byte) (int, error) {
+	n, err := o.Writer.Write(p)
+	if n > 0 {
+		o.rec.event("o", string(p[:n]))
+	}
+	return n, err
+}
+
+// recordingStore owns the recordings directory and the sessions being
+// recorded into it.
+type recordingStore struct {
+	dir    string
+	mu     sync.Mutex
+	active map[string]*recorder
+}
+
+// recordings writes to cfg.RecordingsDir; main sets the path at startup.
+var recordings = &recordingStore{active: make(map[string]*recorder)}
+
+// start begins recording a sampled share of visitor sessions and returns
+// nil for the rest. Admin sessions are never recorded, since they show
+// other visitors' details.
+func (r *recordingStore) start(s ssh.Session, info sessionInfo) *recorder {
+	if !cfg.EnableRecording || info.Admin || rand.IntN(100) >= cfg.RecordingSamplePercent {
+		return nil
+	}
+	if err := os.MkdirAll(r.dir, 0o700); err != nil {
+		sessionLog(s.Context()).Error("Failed to create recordings dir", "err", err)
+		return nil
+	}
+	now := time.Now()
+	name := now.UTC().Format("20060102T150405") + "-" + shortID(info.ID) + recordingExt
+	f, err := os.OpenFile(filepath.Join(r.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		sessionLog(s.Context()).Error("Failed to start recording", "err", err)
+		return nil
+	}
+
+	pty, _, _ := s.Pty()
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     pty.Window.Width,
+		Height:    pty.Window.Height,
+		Timestamp: now.Unix(),
+		Title:     info.User + " " + shortID(info.ID),
+		Env:       map[string]string{"TERM": pty.Term},
+	})
+	if _, err := f.Write(append(header, '\n')); err != nil {
+		f.Close()
+		sessionLog(s.Context()).Error("Failed to start recording", "err", err)
+		return nil
+	}
+	rec := &recorder{f: f, start: now, written: int64(len(header) + 1)}
+
+	r.mu.Lock()
+	r.active[info.ID] = rec
+	r.mu.Unlock()
+	sessionLog(s.Context()).Info("Recording session", "recording", name)
+	return rec
+}
+
+// resized records a terminal resize for a recorded session.
+func (r *recordingStore) resized(id string, width, height int) {
+	r.mu.Lock()
+	rec := r.active[id]
+	r.mu.Unlock()
+	if rec != nil {
+		rec.event("r", fmt.Sprintf("%dx%d", width, height))
+	}
+}
+
+// pause stops or resumes recording a session's output, so what visitors
+// type into forms stays out of recordings. It reports whether a recording
+// was paused or resumed; the screen must then be repainted in full on
+// resume, as the renderer only redraws what changed.
+func (r *recordingStore) pause(id string, paused bool) bool {
+	r.mu.Lock()
+	rec := r.active[id]
+	r.mu.Unlock()
+	return rec != nil && rec.setPaused(paused)
+}
+
+// stop finishes a session's recording, if it has one.
+func (r *recordingStore) stop(id string) {
+	r.mu.Lock()
+	rec := r.active[id]
+	delete(r.active, id)
+	r.mu.Unlock()
+	if rec != nil {
+		rec.close()
+	}
+}
+
+// recordingFile describes a cast file on disk.
+type recordingFile struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// list returns the stored recordings, newest first.
+func (r *recordingStore) list() ([]recordingFile, error) {
+	entries, err := os.ReadDir(r.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recordings: %w", err)
+	}
+	var files []recordingFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), recordingExt) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, recordingFile{Name: e.Name(), Size: fi.Size(), Modified: fi.ModTime()})
+	}
+	// Names start with the UTC start time
+	sort.Slice(files, func(i, j int) bool { return files[i].Name > files[j].Name })
+	return files, nil
+}
+
+// remove deletes a recording by file name.
+func (r *recordingStore) remove(name string) error {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, recordingExt) {
+		return errRecordingNotFound
+	}
+	err := os.Remove(filepath.Join(r.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return errRecordingNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete recording: %w", err)
+	}
+	return nil
+}
+
+// cast is a parsed recording.
+type cast struct {
+	Header castHeader
+	Events []castEvent
+}
+
+// duration is the time of the last event.
+func (c *cast) duration() float64 {
+	if len(c.Events) == 0 {
+		return 0
+	}
+	return c.Events[len(c.Events)-1].Time
+}
+
+// load reads a recording by file name. Long pauses are shortened to
+// replayIdleLimit, and a truncated last line is ignored.
+func (r *recordingStore) load(name string) (*cast, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, recordingExt) {
+		return nil, errRecordingNotFound
+	}
+	f, err := os.Open(filepath.Join(r.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errRecordingNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024) // Full-screen frames are long
+	if !sc.Scan() {
+		return nil, fmt.Errorf("recording %s is empty", name)
+	}
+	c := &cast{}
+	if err := json.Unmarshal(sc.Bytes(), &c.Header); err != nil || c.Header.Version != 2 {
+		return nil, fmt.Errorf("recording %s is not an asciicast v2 file", name)
+	}
+	var last, shift float64
+	limit := replayIdleLimit.Seconds()
+	for sc.Scan() {
+		var e castEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			break
+		}
+		if gap := e.Time - last; gap > limit {
+			shift += gap - limit
+		}
+		last = e.Time
+		e.Time -= shift
+		c.Events = append(c.Events, e)
+	}
+	return c, nil
+}
+
+// prune deletes recordings older than the retention period.
+func (r *recordingStore) prune() {
+	if cfg.RecordingRetention <= 0 {
+		return
+	}
+	files, err := r.list()
+	if err != nil {
+		slog.Error("Failed to prune recordings", "err", err)
+		return
+	}
+	cutoff := time.Now().Add(-cfg.RecordingRetention)
+	removed := 0
+	for _, f := range files {
+		if f.Modified.After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.dir, f.Name)); err != nil {
+			slog.Error("Failed to remove recording", "recording", f.Name, "err", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		slog.Info("Pruned old recordings", "removed", removed, "retention", cfg.RecordingRetention)
+	}
+}
+
+// runPruner prunes on start and then periodically.
+func (r *recordingStore) runPruner() {
+	for {
+		r.prune()
+		time.Sleep(recordingPruneTick)
+	}
+}
+
+// shortID abbreviates a session ID for file names and titles.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestCastEventJSON(t *testing.T) {
+	e := castEvent{Time: 1.25, Kind: "o", Data: "\x1b[31mhi\r\n"}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[1.25,"o","\u001b[31mhi\r\n"]`; string(raw) != want {
+		t.Errorf("got %s, want %s", raw, want)
+	}
+	var back castEvent
+	if err := json.Unmarshal(raw, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back != e {
+		t.Errorf("round trip gave %+v, want %+v", back, e)
+	}
+
+	for _, bad := range []string{`[1, "o"]`, `{"time": 1}`, `["1", "o", "x"]`, `[1, "o", 2]`} {
+		if err := json.Unmarshal([]byte(bad), &back); err == nil {
+			t.Errorf("no error for %s", bad)
+		}
+	}
+}
+
+// writeCast writes a recording with the given header and event lines.
+func writeCast(t *testing.T, dir, name, header string, lines ...string) {
+	t.Helper()
+	data := header + "\n" + strings.Join(lines, "\n")
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordingLoad(t *testing.T) {
+	r := &recordingStore{dir: t.TempDir()}
+	const header = `{"version": 2, "width": 80, "height": 24, "timestamp": 1767322800}`
+	writeCast(t, r.dir, "a.cast", header,
+		`[0, "o", "a"]`,
+		`[1, "o", "b"]`,
+		`[10, "o", "c"]`, // 9s idle, shortened to the limit
+		`[10.5, "r", "100x30"]`,
+		`[30, "o", "d"]`,
+		`[31, "o", "trunc`, // Cut off by a crash
+	)
+	c, err := r.load("a.cast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Header.Width != 80 || c.Header.Height != 24 {
+		t.Errorf("got header %+v", c.Header)
+	}
+	limit := replayIdleLimit.Seconds()
+	want := []float64{0, 1, 1 + limit, 1.5 + limit, 1.5 + 2*limit}
+	if len(c.Events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(c.Events), len(want))
+	}
+	for i, e := range c.Events {
+		if e.Time != want[i] {
+			t.Errorf("event %d at %v, want %v", i, e.Time, want[i])
+		}
+	}
+	if c.duration() != want[len(want)-1] {
+		t.Errorf("got duration %v", c.duration())
+	}
+
+	writeCast(t, r.dir, "v1.cast", `{"version": 1}`)
+	if err := os.WriteFile(filepath.Join(r.dir, "empty.cast"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"v1.cast", "empty.cast"} {
+		if _, err := r.load(name); err == nil {
+			t.Errorf("no error loading %s", name)
+		}
+	}
+	for _, name := range []string{"missing.cast", "../a.cast", "a.json"} {
+		if _, err := r.load(name); !errors.Is(err, errRecordingNotFound) {
+			t.Errorf("load(%q): got %v, want errRecordingNotFound", name, err)
+		}
+	}
+}
+
+func TestRecorderPause(t *testing.T) {
+	setTestConfig(t, config{})
+	path := filepath.Join(t.TempDir(), "a.cast")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{f: f, start: time.Now()}
+	rec.event("o", "before")
+	if !rec.setPaused(true) || rec.setPaused(true) {
+		t.Error("setPaused should report only changes")
+	}
+	rec.event("o", "alice@example.com")
+	rec.event("r", "100x30")
+	rec.setPaused(false)
+	rec.event("o", "after")
+	rec.close()
+
+	var data []string
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		var e castEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, e.Data)
+	}
+	want := []string{"before", recordingPausedNotice, "100x30", "after"}
+	if strings.Join(data, "|") != strings.Join(want, "|") {
+		t.Errorf("recorded %q, want %q", data, want)
+	}
+}
+
+func TestReplayScreen(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "text", input: "hello\r\nworld", want: "hello\nworld\n"},
+		{name: "cursor position", input: "\x1b[2;3Hx\x1b[1;1Hy", want: "y\n  x\n"},
+		{name: "relative moves", input: "ab\x1b[1Bc\x1b[3Dd", want: "ab\nd c\n"},
+		{name: "erase display", input: "abc\r\ndef\x1b[2J\x1b[Hz", want: "z\n\n"},
+		{name: "erase to end of line", input: "abcdef\x1b[1;3H\x1b[K", want: "ab\n\n"},
+		{name: "erase line", input: "abc\x1b[2K", want: "\n\n"},
+		{name: "wrap", input: "abcdefghij", want: "abcdefgh\nij\n"},
+		{name: "scroll", input: "1\r\n2\r\n3\r\n4", want: "2\n3\n4"},
+		{name: "private modes ignored", input: "\x1b[?1049ha\x1b[?25l", want: "a\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newReplayScreen(8, 3)
+			s.write(tt.input)
+			if got := trimLines(s.view(8, 3)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayScreenKeepsStyle(t *testing.T) {
+	s := newReplayScreen(8, 1)
+	s.write("\x1b[31mred\x1b[m")
+	if got := s.view(8, 1); !strings.Contains(got, "red") || !strings.Contains(got, "\x1b[") {
+		t.Errorf("got %q, want styled text", got)
+	}
+	s.resize(2, 1)
+	if got := ansi.Strip(s.view(8, 1)); got != "re" {
+		t.Errorf("got %q after shrinking", got)
+	}
+}
+
+// trimLines drops trailing spaces from each line of a rendered screen.
+func trimLines(view string) string {
+	lines := strings.Split(view, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
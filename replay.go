@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/cellbuf"
+)
+
+const (
+	replayFrame    = 50 * time.Millisecond
+	replaySeekStep = 5.0 // seconds
+	replayMaxSpeed = 8.0
+)
+
+// --- Replay Screen ---
+
+// replayScreen is a small terminal emulator, enough to redraw what Bubble
+// Tea's renderer writes: text, colours, cursor movement and erasing. Modes
+// and other private sequences are ignored.
+type replayScreen struct {
+	buf    *cellbuf.Buffer
+	x, y   int
+	style  cellbuf.Style
+	parser *ansi.Parser
+}
+
+func newReplayScreen(width, height int) *replayScreen {
+	return &replayScreen{
+		buf:    cellbuf.NewBuffer(max(width, 1), max(height, 1)),
+		parser: ansi.NewParser(),
+	}
+}
+
+func (s *replayScreen) resize(width, height int) {
+	s.buf.Resize(max(width, 1), max(height, 1))
+	s.clampCursor()
+}
+
+func (s *replayScreen) clampCursor() {
+	s.x = max(0, min(s.x, s.buf.Width()-1))
+	s.y = max(0, min(s.y, s.buf.Height()-1))
+}
+
+// lineFeed moves down a line, scrolling at the bottom.
+func (s *replayScreen) lineFeed() {
+	if s.y == s.buf.Height()-1 {
+		s.buf.DeleteLine(0, 1, nil)
+		return
+	}
+	s.y++
+}
+
+func (s *replayScreen) write(data string) {
+	var state byte
+	for len(data) > 0 {
+		seq, width, n, newState := ansi.DecodeSequence(data, state, s.parser)
+		state = newState
+		data = data[n:]
+
+		if width > 0 {
+			if s.x+width > s.buf.Width() {
+				s.x = 0
+				s.lineFeed()
+			}
+			cell := cellbuf.NewGraphemeCell(seq)
+			cell.Style = s.style
+			s.buf.SetCell(s.x, s.y, cell)
+			s.x += width
+			continue
+		}
+		switch {
+		case seq == "\r":
+			s.x = 0
+		case seq == "\n":
+			s.lineFeed()
+		case seq == "\b":
+			s.x = max(s.x-1, 0)
+		case ansi.HasCsiPrefix(seq):
+			s.csi(ansi.Cmd(s.parser.Command()), s.parser.Params())
+		}
+	}
+	// The cursor may sit just past the last column until the next character
+	s.x = max(0, min(s.x, s.buf.Width()))
+}
+
+// csi applies a control sequence. Counts of zero mean one, as in a terminal.
+func (s *replayScreen) csi(cmd ansi.Cmd, params ansi.Params) {
+	if cmd.Prefix() != 0 || cmd.Intermediate() != 0 {
+		return // Private modes such as the alt screen
+	}
+	param := func(i, def int) int {
+		v, _, _ := params.Param(i, def)
+		return v
+	}
+	count := max(param(0, 1), 1)
+	w, h := s.buf.Width(), s.buf.Height()
+	switch cmd.Final() {
+	case 'm':
+		cellbuf.ReadStyle(params, &s.style)
+	case 'A':
+		s.y -= count
+	case 'B':
+		s.y += count
+	case 'C':
+		s.x += count
+	case 'D':
+		s.x -= count
+	case 'G':
+		s.x = count - 1
+	case 'H', 'f':
+		s.y = max(param(0, 1), 1) - 1
+		s.x = max(param(1, 1), 1) - 1
+	case 'J':
+		switch param(0, 0) {
+		case 0:
+			s.buf.ClearRect(cellbuf.Rect(s.x, s.y, w-s.x, 1))
+			s.buf.ClearRect(cellbuf.Rect(0, s.y+1, w, h-s.y-1))
+		case 1:
+			s.buf.ClearRect(cellbuf.Rect(0, 0, w, s.y))
+			s.buf.ClearRect(cellbuf.Rect(0, s.y, s.x+1, 1))
+		default:
+			s.buf.Clear()
+		}
+	case 'K':
+		switch param(0, 0) {
+		case 0:
+			s.buf.ClearRect(cellbuf.Rect(s.x, s.y, w-s.x, 1))
+		case 1:
+			s.buf.ClearRect(cellbuf.Rect(0, s.y, s.x+1, 1))
+		default:
+			s.buf.ClearRect(cellbuf.Rect(0, s.y, w, 1))
+		}
+	case 'L':
+		s.buf.InsertLine(s.y, count, nil)
+	case 'M':
+		s.buf.DeleteLine(s.y, count, nil)
+	}
+	s.clampCursor()
+}
+
+// view renders the screen cropped to width × height.
+func (s *replayScreen) view(width, height int) string {
+	lines := make([]string, 0, min(height, s.buf.Height()))
+	for y := 0; y < s.buf.Height() && y < height; y++ {
+		_, line := cellbuf.RenderLine(s.buf, y)
+		lines = append(lines, ansi.Truncate(line, width, ""))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// --- Replay Viewer ---
+
+// replayTickMsg advances a replay by one frame. gen tells ticks scheduled
+// before a pause or seek apart from current ones.
+type replayTickMsg struct {
+	r   *replayModel
+	gen int
+}
+
+// replayModel plays a recording back inside the admin tab.
+type replayModel struct {
+	name   string
+	cast   *cast
+	screen *replayScreen
+	next   int     // index of the next event to apply
+	clock  float64 // playback position in seconds
+	speed  float64
+	paused bool
+	gen    int
+}
+
+func newReplayModel(name string, c *cast) *replayModel {
+	return &replayModel{
+		name:   name,
+		cast:   c,
+		screen: newReplayScreen(c.Header.Width, c.Header.Height),
+		speed:  1,
+	}
+}
+
+func (r *replayModel) tick() tea.Cmd {
+	r.gen++
+	msg := replayTickMsg{r: r, gen: r.gen}
+	return tea.Tick(replayFrame, func(time.Time) tea.Msg { return msg })
+}
+
+// advance applies every event up to position to.
+func (r *replayModel) advance(to float64) {
+	for ; r.next < len(r.cast.Events) && r.cast.Events[r.next].Time <= to; r.next++ {
+		e := r.cast.Events[r.next]
+		switch e.Kind {
+		case "o":
+			r.screen.write(e.Data)
+		case "r":
+			var w, h int
+			if _, err := fmt.Sscanf(e.Data, "%dx%d", &w, &h); err == nil {
+				r.screen.resize(w, h)
+			}
+		}
+	}
+	r.clock = to
+}
+
+// seek jumps to position to, replaying from the start when going back.
+func (r *replayModel) seek(to float64) {
+	to = max(0, min(to, r.cast.duration()))
+	if to < r.clock {
+		r.screen = newReplayScreen(r.cast.Header.Width, r.cast.Header.Height)
+		r.next = 0
+	}
+	r.advance(to)
+}
+
+// update handles a tick or key; done reports that the viewer was closed.
+func (r *replayModel) update(msg tea.Msg) (cmd tea.Cmd, done bool) {
+	switch msg := msg.(type) {
+	case replayTickMsg:
+		if msg.r != r || msg.gen != r.gen || r.paused {
+			return nil, false
+		}
+		r.advance(r.clock + replayFrame.Seconds()*r.speed)
+		if r.clock >= r.cast.duration() {
+			r.paused = true
+			return nil, false
+		}
+		return r.tick(), false
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "q":
+			return nil, true
+		case " ":
+			if r.paused && r.clock >= r.cast.duration() {
+				r.seek(0)
+			}
+			r.paused = !r.paused
+			if !r.paused {
+				return r.tick(), false
+			}
+		case "left", "h":
+			r.seek(r.clock - replaySeekStep)
+		case "right", "l":
+			r.seek(r.clock + replaySeekStep)
+		case "home", "g":
+			r.seek(0)
+		case "+", "=":
+			r.speed = min(r.speed*2, replayMaxSpeed)
+		case "-":
+			r.speed = max(r.speed/2, 1/replayMaxSpeed)
+		}
+	}
+	return nil, false
+}
+
+func (r *replayModel) view(w, h int) string {
+	state := "▶"
+	if r.paused {
+		state = "⏸"
+	}
+	status := styleItemSubtitle.Render(fmt.Sprintf(" %s %s  %.1fs / %.1fs  %gx  %d×%d",
+		state, r.name, r.clock, r.cast.duration(), r.speed, r.screen.buf.Width(), r.screen.buf.Height()))
+	return lipgloss.JoinVertical(lipgloss.Left, status, r.screen.view(w, max(h-1, 1)))
+}
+
+func (r *replayModel) help() string {
+	return "space: play/pause • ←/→: seek 5s • +/-: speed • g: restart • esc: close"
+}
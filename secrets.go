@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var errSecretNotFound = errors.New("secret not found")
+
+// --- Secrets Providers ---
+
+// secretsProvider looks up secrets, such as host keys, by name.
+type secretsProvider interface {
+	// secret returns the named secret, or errSecretNotFound.
+	secret(name string) ([]byte, error)
+	String() string
+}
+
+// secretsProviders builds a provider from the part of secrets-provider after
+// "scheme:", keyed by scheme. Other backends register here.
+var secretsProviders = map[string]func(arg string) (secretsProvider, error){
+	"file": newFileSecrets,
+}
+
+func secretsProviderNames() []string {
+	names := make([]string, 0, len(secretsProviders))
+	for name := range secretsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newSecretsProvider parses a "scheme:argument" spec such as
+// "file:/run/secrets".
+func newSecretsProvider(spec string) (secretsProvider, error) {
+	scheme, arg, _ := strings.Cut(spec, ":")
+	build, ok := secretsProviders[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown secrets provider %q (choose from %s)", scheme, strings.Join(secretsProviderNames(), ", "))
+	}
+	return build(arg)
+}
+
+// fileSecrets reads each secret from a file named after it, the layout of
+// Docker and Kubernetes secret mounts.
+type fileSecrets struct {
+	dir string
+}
+
+func newFileSecrets(dir string) (secretsProvider, error) {
+	if dir == "" {
+		return nil, errors.New("file secrets provider needs a directory, e.g. file:/run/secrets")
+	}
+	return fileSecrets{dir: dir}, nil
+}
+
+func (f fileSecrets) secret(name string) ([]byte, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(f.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errSecretNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func (f fileSecrets) String() string {
+	return "file:" + f.dir
+}
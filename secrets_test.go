@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewSecretsProvider(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr string
+	}{
+		{spec: "file:/run/secrets", want: "file:/run/secrets"},
+		{spec: "file:", wantErr: "needs a directory"},
+		{spec: "vault:secret/ssh", wantErr: `unknown secrets provider "vault"`},
+		{spec: "/run/secrets", wantErr: "unknown secrets provider"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			p, err := newSecretsProvider(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.String() != tt.want {
+				t.Errorf("got %s, want %s", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ssh_host_ed25519_key"), []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := fileSecrets{dir: dir}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{name: "ssh_host_ed25519_key", want: "key"},
+		{name: "ssh_host_rsa_key", wantErr: errSecretNotFound},
+		{name: "../ssh_host_ed25519_key"},
+		{name: ".."},
+		{name: ""},
+	}
+	for _, tt := range tests {
+		got, err := p.secret(tt.name)
+		switch {
+		case tt.want != "":
+			if err != nil || string(got) != tt.want {
+				t.Errorf("secret(%q) = %q, %v", tt.name, got, err)
+			}
+		case tt.wantErr != nil:
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("secret(%q): got %v, want %v", tt.name, err, tt.wantErr)
+			}
+		default:
+			if err == nil || errors.Is(err, errSecretNotFound) {
+				t.Errorf("secret(%q): got %v, want an invalid name error", tt.name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	ssh "github.com/charmbracelet/ssh"
+	wish "github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// --- Session Hub ---
+
+// sessionInfo describes one connected visitor.
+type sessionInfo struct {
+	ID            string
+	User          string
+	RemoteAddr    string
+	ClientVersion string
+	Fingerprint   string // SHA256 fingerprint of the client key, empty for keyless logins
+	Admin         bool
+	Started       time.Time
+	Tab           string
+}
+
+// hubStats is a snapshot of the hub counters shown on the admin tab.
+type hubStats struct {
+	Active   int
+	Peak     int
+	Total    int
+	Visitors int
+	Uptime   time.Duration
+}
+
+// Messages waiting for a program that is not keeping up; more are dropped
+const programQueueSize = 64
+
+// programQueue delivers messages to one tea.Program in the order they were
+// queued. Sends happen on the queue's own goroutine, so a slow program, or
+// one whose Update calls back into the sender, never blocks it.
+type programQueue struct {
+	msgs chan tea.Msg
+}
+
+func newProgramQueue(p *tea.Program) *programQueue {
+	q := &programQueue{msgs: make(chan tea.Msg, programQueueSize)}
+	go func() {
+		for msg := range q.msgs {
+			p.Send(msg)
+		}
+	}()
+	return q
+}
+
+// offer queues msg, dropping it if the program has fallen too far behind.
+func (q *programQueue) offer(msg tea.Msg) {
+	select {
+	case q.msgs <- msg:
+	default:
+	}
+}
+
+// close stops the queue once the messages already in it are sent. The
+// owner must not offer after closing.
+func (q *programQueue) close() {
+	close(q.msgs)
+}
+
+// sessionHub tracks live sessions and their tea.Programs so messages can be
+// pushed to them from outside the Bubble Tea event loop.
+type sessionHub struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionInfo
+	programs map[string]*programQueue
+	visitors map[string]struct{}
+	total    int
+	peak     int
+	started  time.Time
+}
+
+var hub = newSessionHub()
+
+func newSessionHub() *sessionHub {
+	return &sessionHub{
+		sessions: make(map[string]*sessionInfo),
+		programs: make(map[string]*programQueue),
+		visitors: make(map[string]struct{}),
+		started:  time.Now(),
+	}
+}
+
+func (h *sessionHub) join(info *sessionInfo) {
+	h.mu.Lock()
+	h.sessions[info.ID] = info
+	h.total++
+	if len(h.sessions) > h.peak {
+		h.peak = len(h.sessions)
+	}
+	h.visitors[visitorKey(info)] = struct{}{}
+	h.pushPresenceLocked()
+	h.mu.Unlock()
+}
+
+func (h *sessionHub) leave(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.sessions, id)
+	if q, ok := h.programs[id]; ok {
+		q.close()
+		delete(h.programs, id)
+	}
+	h.pushPresenceLocked()
+}
+
+// attach registers the tea.Program serving a session.
+func (h *sessionHub) attach(id string, p *tea.Program) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.sessions[id]; !ok {
+		return
+	}
+	if old, ok := h.programs[id]; ok {
+		old.close()
+	}
+	h.programs[id] = newProgramQueue(p)
+}
+
+func (h *sessionHub) session(id string) (sessionInfo, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	info, ok := h.sessions[id]
+	if !ok {
+		return sessionInfo{}, false
+	}
+	return *info, true
+}
+
+func (h *sessionHub) setTab(id, tab string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if info, ok := h.sessions[id]; ok && info.Tab != tab {
+		info.Tab = tab
+		h.pushPresenceLocked()
+	}
+}
+
+// list returns copies of all live sessions, oldest first.
+func (h *sessionHub) list() []sessionInfo {
+	h.mu.Lock()
+	out := make([]sessionInfo, 0, len(h.sessions))
+	for _, info := range h.sessions {
+		out = append(out, *info)
+	}
+	h.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Started.Before(out[j].Started) })
+	return out
+}
+
+func (h *sessionHub) stats() hubStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return hubStats{
+		Active:   len(h.sessions),
+		Peak:     h.peak,
+		Total:    h.total,
+		Visitors: len(h.visitors),
+		Uptime:   time.Since(h.started),
+	}
+}
+
+// broadcast sends msg to every attached program.
+func (h *sessionHub) broadcast(msg tea.Msg) {
+	h.send(msg, func(*sessionInfo) bool { return true })
+}
+
+// sendToAdmins sends msg to the programs of admin sessions only.
+func (h *sessionHub) sendToAdmins(msg tea.Msg) {
+	h.send(msg, func(info *sessionInfo) bool { return info.Admin })
+}
+
+func (h *sessionHub) send(msg tea.Msg, match func(*sessionInfo) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sendLocked(msg, match)
+}
+
+// sendLocked queues msg for the matching programs. Queuing never blocks, so
+// it is safe under h.mu, and each program sees messages in the order they
+// were sent.
+func (h *sessionHub) sendLocked(msg tea.Msg, match func(*sessionInfo) bool) {
+	for id, q := range h.programs {
+		if info, ok := h.sessions[id]; ok && match(info) {
+			q.offer(msg)
+		}
+	}
+}
+
+// newSessionInfo collects the identifying details of an SSH session.
+func newSessionInfo(s ssh.Session) *sessionInfo {
+	info := &sessionInfo{
+		ID:            s.Context().SessionID(),
+		User:          s.User(),
+		RemoteAddr:    s.RemoteAddr().String(),
+		ClientVersion: s.Context().ClientVersion(),
+		Started:       time.Now(),
+	}
+	if key := s.PublicKey(); key != nil {
+		info.Fingerprint = gossh.FingerprintSHA256(key)
+		info.Admin = admins.authorized(key)
+	}
+	return info
+}
+
+// sessionMiddleware registers every session with the hub, the analytics
+// store and, when sampled, the recorder for its lifetime.
+func sessionMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			info := newSessionInfo(s)
+			hub.join(info)
+			defer hub.leave(info.ID)
+
+			pty, _, _ := s.Pty()
+			analytics.start(info, pty.Window.Width, pty.Window.Height)
+			defer analytics.end(info.ID)
+			defer recordings.stop(info.ID)
+			defer lounge.unsubscribe(info.ID)
+
+			next(s)
+		}
+	}
+}
+
+// hostOnly strips the port from a host:port address.
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	ssh "github.com/charmbracelet/ssh"
+)
+
+// shutdownMsg tells a session the server is going away at the given time.
+type shutdownMsg struct{ at time.Time }
+
+// shutdownTickMsg keeps the restart countdown ticking.
+type shutdownTickMsg struct{}
+
+var styleShutdownBanner = lipgloss.NewStyle().
+	Bold(true).
+	Foreground(lipgloss.Color("0")).
+	Background(lipgloss.Color("214")).
+	Padding(0, 1)
+
+func shutdownTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return shutdownTickMsg{} })
+}
+
+// shutdownBanner renders the countdown shown in place of the help line.
+func shutdownBanner(at time.Time, width int) string {
+	left := time.Until(at).Round(time.Second)
+	if left < 0 {
+		left = 0
+	}
+	text := fmt.Sprintf("⚠ Server restarting — this session closes in %s. Please reconnect shortly.", left)
+	return styleShutdownBanner.Width(width).MaxWidth(width).Render(text)
+}
+
+// gracefulShutdown stops accepting connections, warns every session, waits
+// up to period for visitors to leave and then shuts the server down. A
+// second signal on force skips the wait.
+func gracefulShutdown(srv *ssh.Server, listeners []net.Listener, period time.Duration, force <-chan os.Signal) {
+	ready.unset(checkListener)
+	closeListeners(listeners)
+
+	deadline := time.Now().Add(period)
+	active := hub.stats().Active
+	slog.Info("Draining sessions", "sessions", active, "period", period)
+	hub.broadcast(shutdownMsg{at: deadline})
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+wait:
+	for hub.stats().Active > 0 && time.Now().Before(deadline) {
+		select {
+		case <-ticker.C:
+		case sig := <-force:
+			slog.Warn("Received signal again, not waiting for sessions", "signal", sig.String())
+			break wait
+		}
+	}
+
+	// Let the remaining programs exit cleanly before the connections go
+	hub.broadcast(tea.QuitMsg{})
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("Graceful shutdown timed out, closing remaining connections")
+		_ = srv.Close()
+	} else if err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Error("Error during shutdown", "err", err)
+	}
+	slog.Info("Server stopped")
+}
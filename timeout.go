@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const goodbyeDelay = 3 * time.Second // How long the goodbye screen shows
+
+// Why a session was closed on the server's initiative
+const (
+	closedIdle = "idle"
+	closedMax  = "max"
+)
+
+// sessionTimeoutMsg re-checks the idle and maximum session timeouts.
+type sessionTimeoutMsg struct{}
+
+// goodbyeDoneMsg ends the program once the goodbye screen has shown.
+type goodbyeDoneMsg struct{}
+
+// --- Session Timeouts ---
+
+// timeoutDeadline returns when the session will be closed and why; the
+// zero time means it will not be.
+func (m *model) timeoutDeadline() (time.Time, string) {
+	var at time.Time
+	var reason string
+	if cfg.IdleTimeout > 0 {
+		at, reason = m.lastInput.Add(cfg.IdleTimeout), closedIdle
+	}
+	if cfg.MaxSessionDuration > 0 {
+		if end := m.started.Add(cfg.MaxSessionDuration); at.IsZero() || end.Before(at) {
+			at, reason = end, closedMax
+		}
+	}
+	return at, reason
+}
+
+// checkTimeouts closes the session once its deadline has passed, and
+// otherwise schedules the next check: every second while the warning
+// counts down, or when the warning is due.
+func (m *model) checkTimeouts() tea.Cmd {
+	at, reason := m.timeoutDeadline()
+	if at.IsZero() || m.goodbye != "" {
+		return nil
+	}
+	now := time.Now()
+	if !now.Before(at) {
+		m.goodbye = reason
+		m.logger.Info("Closing session", "timeout", reason)
+		return tea.Tick(goodbyeDelay, func(time.Time) tea.Msg { return goodbyeDoneMsg{} })
+	}
+	wait := time.Second
+	if warnAt := at.Add(-cfg.TimeoutWarning); now.Before(warnAt) {
+		wait = warnAt.Sub(now)
+	}
+	return tea.Tick(wait, func(time.Time) tea.Msg { return sessionTimeoutMsg{} })
+}
+
+// timeoutBanner renders the countdown shown in place of the help line, or
+// "" when the session is not about to be closed.
+func (m *model) timeoutBanner(width int) string {
+	at, reason := m.timeoutDeadline()
+	if at.IsZero() || time.Until(at) > cfg.TimeoutWarning {
+		return ""
+	}
+	left := max(time.Until(at).Round(time.Second), 0)
+	text := fmt.Sprintf("⏳ This session reaches its time limit and closes in %s.", left)
+	if reason == closedIdle {
+		text = fmt.Sprintf("⏳ Still there? Closing this idle session in %s. Press any key to stay.", left)
+	}
+	return styleShutdownBanner.Width(width).MaxWidth(width).Render(text)
+}
+
+// goodbyeView replaces the UI once the session has been timed out.
+func (m *model) goodbyeView() string {
+	why := fmt.Sprintf("This session reached its %s limit.", cfg.MaxSessionDuration)
+	if m.goodbye == closedIdle {
+		why = fmt.Sprintf("You were idle for %s, so this session is closing.", cfg.IdleTimeout)
+	}
+	block := lipgloss.JoinVertical(lipgloss.Center,
+		styleHeaderText.UnsetPadding().Render("Thanks for stopping by! 👋"),
+		"",
+		why,
+		styleItemSubtitle.Render("Reconnect any time."),
+	)
+	return lipgloss.Place(m.w, m.h, lipgloss.Center, lipgloss.Center, block)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const envUpgradeReadyFd = "UPGRADE_READY_FD" // Pipe the new process writes to once it serves
+
+// upgradeTimeout is how long a new process gets to report ready.
+var upgradeTimeout = 30 * time.Second
+
+// selfExe is resolved at startup, before a deploy can replace the binary,
+// so an upgrade execs whatever now sits at the same path.
+var selfExe, _ = os.Executable()
+
+// --- Zero-downtime Upgrades ---
+
+// handoff is a listener passed to the new process under the name it will
+// claim it by (see takeInherited).
+type handoff struct {
+	name string
+	ln   net.Listener
+}
+
+// startUpgrade execs a fresh copy of the binary with the listeners as
+// descriptors 3 and up and waits for it to report ready. If it fails the
+// new process is killed and this one keeps serving.
+func startUpgrade(listeners []handoff) (*os.Process, error) {
+	if selfExe == "" {
+		return nil, errors.New("cannot locate own executable")
+	}
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			restoreNonblock(f)
+			f.Close()
+		}
+	}()
+	names := make([]string, 0, len(listeners))
+	for _, h := range listeners {
+		fl, ok := h.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("listener %s cannot be passed on", listenerName(h.ln))
+		}
+		f, err := fl.File()
+		if err != nil {
+			return nil, fmt.Errorf("failed to duplicate listener %s: %w", listenerName(h.ln), err)
+		}
+		files = append(files, f)
+		names = append(names, h.name)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ready pipe: %w", err)
+	}
+	defer readyR.Close()
+	files = append(files, readyW)
+
+	cmd := exec.Command(selfExe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		envInheritedFds+"="+strconv.Itoa(len(listeners)),
+		envInheritedNames+"="+strings.Join(names, ":"),
+		envUpgradeReadyFd+"="+strconv.Itoa(listenFdsStart+len(listeners)),
+	)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", selfExe, err)
+	}
+	// Drop our write end so the read sees EOF if the child dies
+	readyW.Close()
+	files = files[:len(files)-1]
+	for _, f := range files {
+		restoreNonblock(f)
+	}
+
+	readyc := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		readyc <- err
+	}()
+	select {
+	case err := <-readyc:
+		if err == nil {
+			go cmd.Wait() // Reap it if it exits before we do
+			return cmd.Process, nil
+		}
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, errors.New("new process exited before it was ready")
+	case <-time.After(upgradeTimeout):
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("new process not ready after %s", upgradeTimeout)
+	}
+}
+
+// notifyUpgradeReady tells the process that started us, if any, that we
+// are serving so it can stop accepting.
+func notifyUpgradeReady() {
+	v := os.Getenv(envUpgradeReadyFd)
+	if v == "" {
+		return
+	}
+	os.Unsetenv(envUpgradeReadyFd)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("Invalid upgrade ready fd", "env", envUpgradeReadyFd, "value", v)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		slog.Error("Failed to notify the previous process", "err", err)
+	}
+}
+
+// sdNotify sends a state update to systemd when running under a service
+// with NOTIFY_SOCKET set, e.g. MAINPID after an upgrade.
+func sdNotify(state string) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return
+	}
+	if strings.HasPrefix(addr, "@") {
+		addr = "\x00" + addr[1:] // Abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		slog.Error("Failed to notify systemd", "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Error("Failed to notify systemd", "err", err)
+	}
+}
+
+// upgrade releases what the new process must own, starts it with every
+// listener and, once it serves, closes ours without unlinking Unix sockets.
+// The analytics db is reopened if the upgrade fails.
+func upgrade(listeners []handoff) error {
+	analytics.close() // bbolt holds an exclusive file lock
+	proc, err := startUpgrade(listeners)
+	if err != nil {
+		if cfg.EnableAnalytics {
+			if err := analyticsFromConfig(cfg); err != nil {
+				slog.Error("Failed to reopen analytics", "err", err)
+			}
+		}
+		return err
+	}
+	slog.Info("New process is serving; no longer accepting connections", "pid", proc.Pid)
+	sdNotify("MAINPID=" + strconv.Itoa(proc.Pid))
+
+	ready.unset(checkListener)
+	for _, h := range listeners {
+		if ul, ok := h.ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false) // The new process serves the same path
+		}
+		closeListeners([]net.Listener{h.ln})
+	}
+	return nil
+}
+
+// drainAfterUpgrade lets the sessions left on this process finish on their
+// own. It returns once they have, after upgrade-drain-timeout (0 waits
+// forever) or on SIGINT/SIGTERM; the caller then shuts down as usual.
+// Guestbook, ban and content writes re-read their file under a lock (see
+// withFileLock), so these sessions don't overwrite what the new process
+// saves meanwhile.
+func drainAfterUpgrade(force <-chan os.Signal) {
+	var deadline <-chan time.Time
+	if cfg.UpgradeDrainTimeout > 0 {
+		deadline = time.After(cfg.UpgradeDrainTimeout)
+	}
+	slog.Info("Letting sessions finish on the old process", "sessions", hub.stats().Active)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for hub.stats().Active > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			slog.Warn("Sessions still open after the upgrade drain timeout")
+			return
+		case sig := <-force:
+			slog.Info("Received signal while draining after upgrade", "signal", sig.String())
+			return
+		}
+	}
+}
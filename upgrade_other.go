@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// upgradeSignals is empty where descriptors cannot be passed to a child.
+var upgradeSignals []os.Signal
+
+func restoreNonblock(*os.File) {}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals start a zero-downtime upgrade, see upgrade.
+var upgradeSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
+
+// restoreNonblock undoes the blocking mode exec sets on a passed listener.
+// The flag is shared with our own listener, whose Accept could otherwise
+// block in the kernel where Close cannot interrupt it.
+func restoreNonblock(f *os.File) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return
+	}
+	_ = rc.Control(func(fd uintptr) { _ = syscall.SetNonblock(int(fd), true) })
+}
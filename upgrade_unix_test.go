@@ -0,0 +1,165 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// envUpgradeChild makes TestUpgradeChild act as the new process started by
+// startUpgrade: "serve", "exit" or "hang".
+const envUpgradeChild = "UPGRADE_TEST_CHILD"
+
+// TestUpgradeChild runs in the child process of the handoff tests.
+func TestUpgradeChild(t *testing.T) {
+	mode := os.Getenv(envUpgradeChild)
+	if mode == "" {
+		t.Skip("only runs as the child of an upgrade test")
+	}
+	switch mode {
+	case "exit":
+		os.Exit(3)
+	case "hang":
+		pidFile := os.Getenv("UPGRADE_TEST_PID_FILE")
+		_ = os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0o600)
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+
+	if err := loadInherited(); err != nil {
+		t.Fatal(err)
+	}
+	lns := takeInherited(listenerSSH)
+	if len(lns) != 1 {
+		t.Fatalf("got %d inherited listeners", len(lns))
+	}
+	notifyUpgradeReady()
+	ln := lns[0].(*net.TCPListener)
+	ln.SetDeadline(time.Now().Add(10 * time.Second))
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("served by the new process\n"))
+	conn.Close()
+	os.Exit(0)
+}
+
+// runUpgrade starts this test binary as the new process in the given mode,
+// with its output in a file so it doesn't mix with the test's.
+func runUpgrade(t *testing.T, mode string, ln net.Listener) (*os.Process, error) {
+	t.Helper()
+	t.Setenv(envUpgradeChild, mode)
+	savedArgs, savedOut, savedErr := os.Args, os.Stdout, os.Stderr
+	defer func() { os.Args, os.Stdout, os.Stderr = savedArgs, savedOut, savedErr }()
+	out, err := os.Create(filepath.Join(t.TempDir(), "child.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	os.Args = []string{os.Args[0], "-test.run=^TestUpgradeChild$"}
+	os.Stdout, os.Stderr = out, out
+	return startUpgrade([]handoff{{name: listenerSSH, ln: ln}})
+}
+
+func TestUpgradeHandsOffListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, err := runUpgrade(t, "serve", ln); err != nil {
+		t.Fatal(err)
+	}
+	ln.Close() // As upgrade does once the new process is ready
+
+	// The new process serves the same socket
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.Contains(line, "new process") {
+		t.Errorf("got %q (%v)", line, err)
+	}
+}
+
+func TestUpgradeChildExits(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, err := runUpgrade(t, "exit", ln); err == nil || !strings.Contains(err.Error(), "exited before it was ready") {
+		t.Fatalf("got %v, want an early exit error", err)
+	}
+	assertStillAccepts(t, ln)
+}
+
+func TestUpgradeTimeoutKillsChild(t *testing.T) {
+	saved := upgradeTimeout
+	t.Cleanup(func() { upgradeTimeout = saved })
+	upgradeTimeout = 2 * time.Second
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	t.Setenv("UPGRADE_TEST_PID_FILE", pidFile)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, err := runUpgrade(t, "hang", ln); err == nil || !strings.Contains(err.Error(), "not ready after") {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	raw, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("child never started: %v", err)
+	}
+	pid, _ := strconv.Atoi(string(raw))
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Errorf("child %d still exists after the timeout (%v)", pid, err)
+	}
+	assertStillAccepts(t, ln)
+}
+
+// assertStillAccepts checks that a failed upgrade left ln serving here.
+// Passing the descriptor on shares its flags with ours, so it must also be
+// back in non-blocking mode, or Close could not interrupt Accept.
+func assertStillAccepts(t *testing.T, ln net.Listener) {
+	t.Helper()
+	rc, err := ln.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Control(func(fd uintptr) {
+		flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFL, 0)
+		if errno != 0 {
+			t.Errorf("failed to read listener flags: %v", errno)
+		} else if flags&syscall.O_NONBLOCK == 0 {
+			t.Error("listener is in blocking mode after the handoff")
+		}
+	})
+
+	go func() {
+		if conn, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+			conn.Close()
+		}
+	}()
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("listener no longer accepts after a failed upgrade: %v", err)
+	}
+	conn.Close()
+}